@@ -0,0 +1,286 @@
+// Package auth holds the keys used to sign and verify JWTs.
+//
+// Keys are loaded once at startup. JWT_SECRET configures a single HS256 key
+// with kid "default". JWT_KEYS_DIR points to a directory of keys named after
+// their kid:
+//
+//	<kid>.secret  HMAC secret, signs and verifies with HS256
+//	<kid>.pem     RSA or Ed25519 private key, signs with RS256 or EdDSA
+//	<kid>.pub     RSA or Ed25519 public key, verification only
+//
+// Every loaded key verifies tokens carrying its kid, so old keys can stay in
+// the directory while tokens signed with them expire. JWT_SIGNING_KID picks
+// the key new tokens are signed with; it may be left out when only one key
+// can sign.
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// minSecretLength is the shortest HMAC secret accepted, in bytes
+const minSecretLength = 32
+
+// Key is one signing or verification key
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	SigningKey interface{}
+	VerifyKey  interface{}
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.SigningKey != nil
+}
+
+// Keyring is the set of keys tokens are verified against, and the key new
+// tokens are signed with.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+var keyring *Keyring
+
+// Init loads the keyring from the environment. It fails when no usable
+// signing key is configured, so the server never accepts tokens signed with
+// an empty secret.
+func Init() error {
+	ring, err := LoadKeyring()
+	if err != nil {
+		return err
+	}
+	keyring = ring
+	return nil
+}
+
+// LoadKeyring builds a keyring from JWT_SECRET, JWT_KEYS_DIR and
+// JWT_SIGNING_KID.
+func LoadKeyring() (*Keyring, error) {
+	var keys []*Key
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := hmacKey("default", []byte(secret))
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SECRET: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		loaded, err := loadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, loaded...)
+	}
+
+	return NewKeyring(os.Getenv("JWT_SIGNING_KID"), keys...)
+}
+
+// NewKeyring builds a keyring from keys, signing with the key signingKID.
+// An empty signingKID is allowed when exactly one key can sign.
+func NewKeyring(signingKID string, keys ...*Key) (*Keyring, error) {
+	ring := &Keyring{keys: map[string]*Key{}}
+	var signers []*Key
+	for _, key := range keys {
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		ring.keys[key.ID] = key
+		if key.CanSign() {
+			signers = append(signers, key)
+		}
+	}
+
+	switch {
+	case signingKID != "":
+		key, ok := ring.keys[signingKID]
+		if !ok || !key.CanSign() {
+			return nil, fmt.Errorf("JWT_SIGNING_KID %q is not a loaded private key or secret", signingKID)
+		}
+		ring.signing = key
+	case len(signers) == 1:
+		ring.signing = signers[0]
+	case len(signers) == 0:
+		return nil, errors.New("no JWT signing key configured, set JWT_SECRET or JWT_KEYS_DIR")
+	default:
+		return nil, errors.New("several JWT signing keys loaded, set JWT_SIGNING_KID")
+	}
+
+	return ring, nil
+}
+
+// Sign signs claims with the keyring's signing key
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.signing.Method, claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.SigningKey)
+}
+
+// Parse verifies a token against the key named by its kid header and
+// returns its claims.
+func (r *Keyring) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set, so other services can
+// verify tokens. HMAC secrets are never published.
+func (r *Keyring) JWKS() map[string]interface{} {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := []map[string]string{}
+	for _, id := range ids {
+		key := r.keys[id]
+		jwk := map[string]string{
+			"kid": key.ID,
+			"alg": key.Method.Alg(),
+			"use": "sig",
+		}
+		switch pub := key.VerifyKey.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// Sign signs claims with the process keyring
+func Sign(claims jwt.Claims) (string, error) {
+	if keyring == nil {
+		return "", errors.New("JWT keyring not initialised")
+	}
+	return keyring.Sign(claims)
+}
+
+// Parse verifies a token with the process keyring
+func Parse(tokenString string) (jwt.MapClaims, error) {
+	if keyring == nil {
+		return nil, errors.New("JWT keyring not initialised")
+	}
+	return keyring.Parse(tokenString)
+}
+
+// JWKS returns the public keys of the process keyring
+func JWKS() map[string]interface{} {
+	if keyring == nil {
+		return map[string]interface{}{"keys": []interface{}{}}
+	}
+	return keyring.JWKS()
+}
+
+func hmacKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("HMAC secret must be at least %d bytes", minSecretLength)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, SigningKey: secret, VerifyKey: secret}, nil
+}
+
+func loadDir(dir string) ([]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("JWT_KEYS_DIR: %w", err)
+	}
+
+	var keys []*Key
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		id := strings.TrimSuffix(entry.Name(), ext)
+		if ext != ".secret" && ext != ".pem" && ext != ".pub" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", entry.Name(), err)
+		}
+
+		var key *Key
+		switch ext {
+		case ".secret":
+			key, err = hmacKey(id, []byte(strings.TrimSpace(string(data))))
+		case ".pem":
+			key, err = privateKey(id, data)
+		case ".pub":
+			key, err = publicKey(id, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", entry.Name(), err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func privateKey(id string, data []byte) (*Key, error) {
+	if priv, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		signer := priv.(crypto.Signer)
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, SigningKey: priv, VerifyKey: signer.Public()}, nil
+	}
+	if priv, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, SigningKey: priv, VerifyKey: &priv.PublicKey}, nil
+	}
+	return nil, errors.New("not an Ed25519 or RSA private key")
+}
+
+func publicKey(id string, data []byte) (*Key, error) {
+	if pub, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, VerifyKey: pub}, nil
+	}
+	if pub, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, VerifyKey: pub}, nil
+	}
+	return nil, errors.New("not an Ed25519 or RSA public key")
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestNewKeyringRefusesMissingOrShortKeys(t *testing.T) {
+	if _, err := NewKeyring(""); err == nil {
+		t.Error("NewKeyring with no keys succeeded")
+	}
+	if _, err := hmacKey("short", []byte("secret")); err == nil {
+		t.Error("hmacKey accepted a short secret")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := hmacKey("old", []byte(strings.Repeat("a", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := &Key{ID: "current", Method: jwt.SigningMethodEdDSA, SigningKey: priv, VerifyKey: pub}
+
+	before, err := NewKeyring("", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(jwt.MapClaims{"userID": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewKeyring("current", old, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := after.Sign(jwt.MapClaims{"userID": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := after.Parse(token); err != nil {
+			t.Errorf("Parse after rotation: %v", err)
+		}
+	}
+	if _, err := before.Parse(newToken); err == nil {
+		t.Error("token signed with an unknown kid was accepted")
+	}
+
+	jwks := after.JWKS()["keys"].([]map[string]string)
+	if len(jwks) != 1 || jwks[0]["kid"] != "current" {
+		t.Errorf("JWKS = %v, want only the public key", jwks)
+	}
+}
+
+func TestParseRejectsAlgorithmMismatch(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := NewKeyring("", &Key{ID: "k", Method: jwt.SigningMethodEdDSA, SigningKey: priv, VerifyKey: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 keyed with the public key, the classic algorithm confusion
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"isAdmin": true})
+	token.Header["kid"] = "k"
+	forged, err := token.SignedString([]byte(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Parse(forged); err == nil {
+		t.Error("token with a mismatched algorithm was accepted")
+	}
+}
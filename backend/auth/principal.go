@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"ctf-backend/config"
+	"ctf-backend/models"
+)
+
+// principalKey is the c.Locals key holding the request's *Principal
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request. The role and ban state
+// come from the database, not from the token, so demotions and bans apply
+// within the cache TTL instead of when the token expires.
+type Principal struct {
+	UserID    primitive.ObjectID
+	Username  string
+	Role      string
+	Ban       *models.UserBan
+	Verified  bool
+	TwoFactor bool
+	SessionID string
+	TokenID   string
+
+	// Set when the request uses a personal API token instead of a session.
+	// Such requests are limited to the token's scopes and never get admin
+	// or author powers.
+	APIToken bool
+	Scopes   []string
+}
+
+// ID returns the caller's user ID, or the zero ID for anonymous requests
+func (p *Principal) ID() primitive.ObjectID {
+	if p == nil {
+		return primitive.NilObjectID
+	}
+	return p.UserID
+}
+
+// IsAdmin reports whether the caller is an admin. When the event requires
+// 2FA for admins, an admin account without it has no admin powers.
+func (p *Principal) IsAdmin() bool {
+	return p != nil && p.Role == models.RoleAdmin && !p.APIToken && !p.NeedsTwoFactor()
+}
+
+// NeedsTwoFactor reports whether the caller is an admin who must enrol in
+// 2FA before using admin powers
+func (p *Principal) NeedsTwoFactor() bool {
+	return p != nil && p.Role == models.RoleAdmin && !p.TwoFactor && config.AdminTwoFactorRequired()
+}
+
+// CanAuthor reports whether the caller may author challenges
+func (p *Principal) CanAuthor() bool {
+	return p != nil && !p.APIToken && (p.Role == models.RoleAuthor || p.IsAdmin())
+}
+
+// HasScope reports whether the caller may act with scope. Session logins
+// have every scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	if !p.APIToken {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// FromContext returns the request's principal, or nil when the request is
+// anonymous. The methods of Principal are safe to call on nil.
+func FromContext(c *fiber.Ctx) *Principal {
+	p, _ := c.Locals(principalKey).(*Principal)
+	return p
+}
+
+// SetPrincipal stores the principal on the request
+func SetPrincipal(c *fiber.Ctx, p *Principal) {
+	c.Locals(principalKey, p)
+}
+
+type cachedUser struct {
+	username  string
+	role      string
+	ban       *models.UserBan
+	verified  bool
+	twoFactor bool
+	expires   time.Time
+}
+
+var (
+	cacheMu    sync.Mutex
+	cache      = map[primitive.ObjectID]cachedUser{}
+	cacheSwept time.Time
+)
+
+// LoadPrincipal resolves the role and ban state of a user, using a short
+// lived cache in front of the users collection. mongo.ErrNoDocuments is
+// returned for users that no longer exist.
+func LoadPrincipal(ctx context.Context, users *mongo.Collection, userID primitive.ObjectID) (*Principal, error) {
+	cacheMu.Lock()
+	entry, ok := cache[userID]
+	if ok && time.Now().After(entry.expires) {
+		delete(cache, userID)
+		ok = false
+	}
+	cacheMu.Unlock()
+
+	if !ok {
+		var user models.User
+		if err := users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+			return nil, err
+		}
+		entry = cachedUser{
+			username:  user.Username,
+			role:      user.Role,
+			ban:       user.Ban,
+			verified:  user.EmailVerified,
+			twoFactor: user.TwoFactorEnabled(),
+			expires:   time.Now().Add(config.PrincipalCacheTTL()),
+		}
+
+		cacheMu.Lock()
+		sweepCache()
+		cache[userID] = entry
+		cacheMu.Unlock()
+	}
+
+	return &Principal{
+		UserID:    userID,
+		Username:  entry.username,
+		Role:      entry.role,
+		Ban:       entry.ban,
+		Verified:  entry.verified,
+		TwoFactor: entry.twoFactor,
+	}, nil
+}
+
+// sweepCache drops expired entries of users that stopped making requests,
+// at most once per TTL. The caller holds cacheMu.
+func sweepCache() {
+	now := time.Now()
+	if now.Sub(cacheSwept) < config.PrincipalCacheTTL() {
+		return
+	}
+	cacheSwept = now
+	for id, entry := range cache {
+		if now.After(entry.expires) {
+			delete(cache, id)
+		}
+	}
+}
+
+// Forget drops a user from the principal cache. Call it after changing a
+// user's role, ban, verification or 2FA state so the change applies on the next request.
+func Forget(userID primitive.ObjectID) {
+	cacheMu.Lock()
+	delete(cache, userID)
+	cacheMu.Unlock()
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Token purposes. Purpose tokens are signed with the same keyring as access
+// tokens but are never accepted as one.
+const (
+	PurposeVerifyEmail    = "verify-email"
+	PurposeLoginChallenge = "login-challenge"
+)
+
+// SignPurpose signs a single purpose token for subject, valid for ttl
+func SignPurpose(purpose, subject string, extra jwt.MapClaims, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	now := time.Now()
+	claims["purpose"] = purpose
+	claims["sub"] = subject
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	return Sign(claims)
+}
+
+// ParsePurpose verifies a purpose token and checks it was issued for purpose
+func ParsePurpose(tokenString, purpose string) (jwt.MapClaims, error) {
+	claims, err := Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims["purpose"] != purpose {
+		return nil, errors.New("token was issued for another purpose")
+	}
+	return claims, nil
+}
+
+// APITokenPrefix starts every personal API token, so they are easy to tell
+// from JWTs and to spot in leaked code
+const APITokenPrefix = "ctf_"
+
+// HashToken hashes an opaque token for storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
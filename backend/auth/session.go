@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"ctf-backend/config"
+	"ctf-backend/models"
+)
+
+type cachedSession struct {
+	ended   bool
+	expires time.Time
+}
+
+var (
+	sessionCacheMu    sync.Mutex
+	sessionCache      = map[primitive.ObjectID]cachedSession{}
+	sessionCacheSwept time.Time
+)
+
+// SessionEnded reports whether the session an access token was issued for
+// has been revoked, has expired or no longer exists. Every access token a
+// session ever issued dies with it, not only the latest one. Answers are
+// cached like principals; call ForgetSession after revoking.
+func SessionEnded(ctx context.Context, sessions *mongo.Collection, sessionID primitive.ObjectID) (bool, error) {
+	sessionCacheMu.Lock()
+	entry, ok := sessionCache[sessionID]
+	if ok && !time.Now().Before(entry.expires) {
+		delete(sessionCache, sessionID)
+		ok = false
+	}
+	sessionCacheMu.Unlock()
+	if ok {
+		return entry.ended, nil
+	}
+
+	var session models.Session
+	err := sessions.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return false, err
+	}
+	entry = cachedSession{
+		ended:   err == mongo.ErrNoDocuments || !session.Active(),
+		expires: time.Now().Add(config.PrincipalCacheTTL()),
+	}
+
+	sessionCacheMu.Lock()
+	sweepSessionCache()
+	sessionCache[sessionID] = entry
+	sessionCacheMu.Unlock()
+
+	return entry.ended, nil
+}
+
+// sweepSessionCache drops expired entries of sessions that are not checked
+// again, at most once per TTL. The caller holds sessionCacheMu.
+func sweepSessionCache() {
+	now := time.Now()
+	if now.Sub(sessionCacheSwept) < config.PrincipalCacheTTL() {
+		return
+	}
+	sessionCacheSwept = now
+	for id, entry := range sessionCache {
+		if !now.Before(entry.expires) {
+			delete(sessionCache, id)
+		}
+	}
+}
+
+// ForgetSession drops the cached state of a session
+func ForgetSession(sessionID primitive.ObjectID) {
+	sessionCacheMu.Lock()
+	delete(sessionCache, sessionID)
+	sessionCacheMu.Unlock()
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func sessionDoc(id primitive.ObjectID, revoked bool) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "expiresAt", Value: time.Now().Add(time.Hour)},
+	}
+	if revoked {
+		doc = append(doc, bson.E{Key: "revokedAt", Value: time.Now()})
+	}
+	return doc
+}
+
+func TestSessionEnded(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+
+	mt.Run("revoked session rejects older access tokens", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "ctf.sessions", mtest.FirstBatch, sessionDoc(id, false)))
+		ended, err := SessionEnded(ctx, mt.Coll, id)
+		if err != nil || ended {
+			mt.Fatalf("active session: ended = %v, err = %v", ended, err)
+		}
+
+		// Revoking forgets the cached state, so the next check sees it
+		ForgetSession(id)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "ctf.sessions", mtest.FirstBatch, sessionDoc(id, true)))
+		ended, err = SessionEnded(ctx, mt.Coll, id)
+		if err != nil || !ended {
+			mt.Fatalf("revoked session: ended = %v, err = %v", ended, err)
+		}
+
+		// Cached: no mock response is queued, a lookup would fail
+		if ended, err = SessionEnded(ctx, mt.Coll, id); err != nil || !ended {
+			mt.Fatalf("cached revoked session: ended = %v, err = %v", ended, err)
+		}
+	})
+
+	mt.Run("missing session counts as ended", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "ctf.sessions", mtest.FirstBatch))
+		ended, err := SessionEnded(ctx, mt.Coll, primitive.NewObjectID())
+		if err != nil || !ended {
+			mt.Fatalf("missing session: ended = %v, err = %v", ended, err)
+		}
+	})
+}
+
+func TestSessionCacheSweepsExpiredEntries(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+
+	mt.Run("expired entries are dropped", func(mt *mtest.T) {
+		stale := primitive.NewObjectID()
+		sessionCacheMu.Lock()
+		sessionCache[stale] = cachedSession{expires: time.Now().Add(-time.Minute)}
+		sessionCacheSwept = time.Time{}
+		sessionCacheMu.Unlock()
+
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "ctf.sessions", mtest.FirstBatch, sessionDoc(id, false)))
+		if _, err := SessionEnded(ctx, mt.Coll, id); err != nil {
+			mt.Fatal(err)
+		}
+
+		sessionCacheMu.Lock()
+		_, kept := sessionCache[stale]
+		sessionCacheMu.Unlock()
+		if kept {
+			mt.Error("expired session entry was not swept")
+		}
+		ForgetSession(id)
+	})
+}
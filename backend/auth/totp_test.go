@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(key, uint64(tt.unix/totpPeriod), 8); got != tt.want {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second), 0)
+	if !ok {
+		t.Fatal("code from the previous step was refused")
+	}
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("code was accepted twice")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(3*totpPeriod*time.Second), 0); ok {
+		t.Error("code outside the skew window was accepted")
+	}
+}
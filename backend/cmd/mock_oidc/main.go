@@ -0,0 +1,38 @@
+// Command mock_oidc runs a local OpenID Connect issuer for trying the OIDC
+// login without a real provider. Every login is approved as the user given
+// by the flags. Point the backend at it with
+//
+//	OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=ctf
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"ctf-backend/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	clientID := flag.String("client", "ctf", "client id")
+	subject := flag.String("sub", "mock-user-1", "subject of the logged in user")
+	username := flag.String("username", "mockplayer", "preferred_username claim")
+	email := flag.String("email", "mockplayer@example.com", "email claim")
+	verified := flag.Bool("verified", true, "email_verified claim")
+	flag.Parse()
+
+	issuer, err := oidctest.New("http://"+*addr, *clientID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	issuer.Claims = map[string]interface{}{
+		"sub":                *subject,
+		"preferred_username": *username,
+		"email":              *email,
+		"email_verified":     *verified,
+	}
+
+	log.Printf("Mock OIDC issuer at http://%s for client %q", *addr, *clientID)
+	log.Fatal(http.ListenAndServe(*addr, issuer.Handler()))
+}
@@ -25,6 +25,7 @@ func main() {
 	defer database.CloseDB()
 
 	seedUsers()
+	seedCategories()
 	seedChallenges()
 
 	fmt.Println("Seeding completed successfully!")
@@ -85,6 +86,30 @@ func seedUsers() {
 // Let's just import options above.
 // Wait, I forgot to import options. Adding it now.
 
+func seedCategories() {
+	ctx := context.Background()
+
+	for i, name := range models.DefaultCategories {
+		_, err := database.Categories.UpdateOne(ctx,
+			bson.M{"name": name},
+			bson.M{
+				"$setOnInsert": bson.M{
+					"name":      name,
+					"order":     i,
+					"createdAt": time.Now(),
+					"updatedAt": time.Now(),
+				},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Failed to seed category %s: %v", name, err)
+		} else {
+			log.Printf("Seeded category: %s", name)
+		}
+	}
+}
+
 func seedChallenges() {
 	ctx := context.Background()
 
@@ -96,6 +121,7 @@ func seedChallenges() {
 			Points:      100,
 			Description: "You need to find the hidden location by analyzing the GPS coordinates in the request.",
 			Flag:        "CTF{gps_sp00f1ng_1s_fun}",
+			Tags:        []string{"osint", "leaflet"},
 			AuthorID:    primitive.NewObjectID(), // Mock ID
 			IsActive:    true,
 			MapConfig: &models.MapConfig{
@@ -117,6 +143,7 @@ func seedChallenges() {
 			Points:      200,
 			Description: "Exploit a vulnerability in the GeoJSON parsing to reveal the flag.",
 			Flag:        "CTF{ge0j50n_1nj3ct10n_ftw}",
+			Tags:        []string{"geojson"},
 			AuthorID:    primitive.NewObjectID(),
 			IsActive:    true,
 			MapConfig: &models.MapConfig{
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventEnd returns the end of the event from EVENT_END (RFC 3339).
+// The second value is false when it is not configured.
+func EventEnd() (time.Time, bool) {
+	return envTime("EVENT_END")
+}
+
+// EventEnded reports whether EVENT_END is set and has passed
+func EventEnded() bool {
+	end, ok := EventEnd()
+	return ok && time.Now().After(end)
+}
+
+func envTime(key string) (time.Time, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ScoreboardFreeze returns the moment the public scoreboard freezes, from
+// SCOREBOARD_FREEZE (RFC 3339). Solves after it stay hidden from players.
+func ScoreboardFreeze() (time.Time, bool) {
+	return envTime("SCOREBOARD_FREEZE")
+}
+
+// ScoreboardFrozen reports whether SCOREBOARD_FREEZE is set and has passed
+func ScoreboardFrozen() bool {
+	freeze, ok := ScoreboardFreeze()
+	return ok && time.Now().After(freeze)
+}
+
+// MaxTeamSize returns the team size limit from MAX_TEAM_SIZE. Zero means
+// teams are unlimited.
+func MaxTeamSize() int {
+	n, err := strconv.Atoi(os.Getenv("MAX_TEAM_SIZE"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// TeamRequestTTL returns how long a team join request stays open, from
+// TEAM_REQUEST_TTL (a Go duration such as "48h"). Defaults to 72 hours.
+func TeamRequestTTL() time.Duration {
+	return envDuration("TEAM_REQUEST_TTL", 72*time.Hour)
+}
+
+// AccessTokenTTL returns the lifetime of access tokens, from
+// ACCESS_TOKEN_TTL. Defaults to 15 minutes.
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL returns how long a session can be refreshed without
+// logging in again, from REFRESH_TOKEN_TTL. Defaults to 30 days.
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// PrincipalCacheTTL returns how long a user's role and ban state are cached
+// by the auth middleware, from AUTH_CACHE_TTL. Defaults to 30 seconds.
+func PrincipalCacheTTL() time.Duration {
+	return envDuration("AUTH_CACHE_TTL", 30*time.Second)
+}
+
+// EmailVerificationRequired reports whether players must verify their email
+// before submitting flags, from REQUIRE_EMAIL_VERIFICATION.
+func EmailVerificationRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_EMAIL_VERIFICATION"))
+	return required
+}
+
+// EmailVerificationTTL returns how long a verification link stays valid,
+// from EMAIL_VERIFICATION_TTL. Defaults to 24 hours.
+func EmailVerificationTTL() time.Duration {
+	return envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// AppURL returns the public URL of the frontend used in emailed links, from
+// APP_URL, without a trailing slash.
+func AppURL() string {
+	url := os.Getenv("APP_URL")
+	if url == "" {
+		url = "http://localhost:3000"
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// PasswordResetTTL returns how long a password reset link stays valid,
+// from PASSWORD_RESET_TTL. Defaults to one hour.
+func PasswordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// PasswordResetCooldown returns how long an account waits before another
+// reset link is sent, from PASSWORD_RESET_COOLDOWN. Defaults to 5 minutes.
+func PasswordResetCooldown() time.Duration {
+	return envDuration("PASSWORD_RESET_COOLDOWN", 5*time.Minute)
+}
+
+// AdminTwoFactorRequired reports whether admin accounts must use 2FA to
+// keep admin powers, from REQUIRE_ADMIN_2FA.
+func AdminTwoFactorRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_ADMIN_2FA"))
+	return required
+}
+
+// LoginChallengeTTL returns how long a user has to enter their 2FA code
+// after the password step, from LOGIN_CHALLENGE_TTL. Defaults to 5 minutes.
+func LoginChallengeTTL() time.Duration {
+	return envDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute)
+}
+
+// EventName returns the name of the event shown in emails and
+// authenticator apps, from EVENT_NAME.
+func EventName() string {
+	if name := os.Getenv("EVENT_NAME"); name != "" {
+		return name
+	}
+	return "CTF"
+}
+
+// OIDCAutoProvision reports whether OIDC logins from unknown users create
+// an account, from OIDC_AUTO_PROVISION. Defaults to true.
+func OIDCAutoProvision() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("OIDC_AUTO_PROVISION"))
+	return err != nil || enabled
+}
+
+// UsernameChangeInterval returns how long a user has to wait between
+// username changes, from USERNAME_CHANGE_INTERVAL. Defaults to 30 days.
+func UsernameChangeInterval() time.Duration {
+	return envDuration("USERNAME_CHANGE_INTERVAL", 30*24*time.Hour)
+}
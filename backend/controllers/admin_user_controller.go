@@ -0,0 +1,672 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/mailer"
+	"ctf-backend/models"
+)
+
+// AdminUserController lets admins search and manage accounts. Every change
+// is written to the audit log along with the admin who made it.
+type AdminUserController struct {
+	collection            *mongo.Collection
+	submissionCollection  *mongo.Collection
+	challengeCollection   *mongo.Collection
+	teamCollection        *mongo.Collection
+	teamRequestCollection *mongo.Collection
+	sessionCollection     *mongo.Collection
+	revokedCollection     *mongo.Collection
+	resetCollection       *mongo.Collection
+	tokenCollection       *mongo.Collection
+	auditCollection       *mongo.Collection
+	mailer                mailer.Mailer
+}
+
+func NewAdminUserController(db *mongo.Database) *AdminUserController {
+	return &AdminUserController{
+		collection:            db.Collection("users"),
+		submissionCollection:  db.Collection("submissions"),
+		challengeCollection:   db.Collection("challenges"),
+		teamCollection:        db.Collection("teams"),
+		teamRequestCollection: db.Collection("team_requests"),
+		sessionCollection:     db.Collection("sessions"),
+		revokedCollection:     db.Collection("revoked_tokens"),
+		resetCollection:       db.Collection("password_resets"),
+		tokenCollection:       db.Collection("api_tokens"),
+		auditCollection:       db.Collection("audit_logs"),
+		mailer:                mailer.Default(),
+	}
+}
+
+var adminUserSortFields = map[string]string{
+	"newest": "createdAt",
+	"score":  "score",
+}
+
+// GetUsers lists users, newest first by default. q searches usernames,
+// display names and emails; role, banned and hidden narrow the list.
+func (ac *AdminUserController) GetUsers(c *fiber.Ctx) error {
+	conditions := bson.A{}
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"username": pattern},
+			bson.M{"email": pattern},
+			bson.M{"displayName": pattern},
+		}})
+	}
+	if role := c.Query("role"); role != "" {
+		conditions = append(conditions, bson.M{"role": role})
+	}
+	if banned := c.Query("banned"); banned != "" {
+		active := bson.M{"ban": bson.M{"$exists": true}, "$or": bson.A{
+			bson.M{"ban.until": bson.M{"$exists": false}},
+			bson.M{"ban.until": bson.M{"$gt": time.Now()}},
+		}}
+		if banned == "true" {
+			conditions = append(conditions, active)
+		} else {
+			conditions = append(conditions, bson.M{"$nor": bson.A{active}})
+		}
+	}
+	if hidden := c.Query("hidden"); hidden != "" {
+		if hidden == "true" {
+			conditions = append(conditions, bson.M{"hidden": true})
+		} else {
+			conditions = append(conditions, bson.M{"hidden": bson.M{"$ne": true}})
+		}
+	}
+
+	sortField, ok := adminUserSortFields[c.Query("sort", "newest")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be newest or score",
+		})
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		value, lastID, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		var sortValue interface{} = value
+		if sortField == "createdAt" {
+			sortValue = time.UnixMilli(value)
+		}
+		conditions = append(conditions, cursorFilter(sortField, sortValue, lastID, true))
+	}
+
+	filter := bson.M{}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	limit := pageLimit(c)
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := ac.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode users",
+		})
+	}
+
+	nextCursor := ""
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		value := last.CreatedAt.UnixMilli()
+		if sortField == "score" {
+			value = int64(last.Score)
+		}
+		nextCursor = encodeCursor(value, last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"users":      users,
+		"nextCursor": nextCursor,
+	})
+}
+
+// GetUser returns the full record of a user
+func (ac *AdminUserController) GetUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findTarget(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	return c.JSON(user)
+}
+
+// SetRole changes a user's role
+func (ac *AdminUserController) SetRole(c *fiber.Ctx) error {
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if input.Role != models.RoleUser && input.Role != models.RoleAuthor && input.Role != models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be user, author or admin",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findOther(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if _, err := ac.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"role": input.Role}}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update role",
+		})
+	}
+	auth.Forget(user.ID)
+	ac.record(ctx, c, models.AuditUserRole, user, map[string]interface{}{
+		"from": user.Role,
+		"to":   input.Role,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated",
+		"role":    input.Role,
+	})
+}
+
+// Ban bans a user until the given time, or for good when until is left
+// out, and ends their sessions
+func (ac *AdminUserController) Ban(c *fiber.Ctx) error {
+	var input struct {
+		Reason string     `json:"reason"`
+		Until  *time.Time `json:"until"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "reason is required",
+		})
+	}
+	if input.Until != nil && !input.Until.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "until must be in the future",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findOther(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ban := models.UserBan{
+		Reason:   input.Reason,
+		Until:    input.Until,
+		BannedBy: auth.FromContext(c).ID(),
+		BannedAt: time.Now(),
+	}
+	if _, err := ac.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"ban": ban}}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to ban user",
+		})
+	}
+	auth.Forget(user.ID)
+	if _, err := revokeSessions(ctx, ac.sessionCollection, ac.revokedCollection, bson.M{"user": user.ID}); err != nil {
+		log.Printf("Error revoking sessions of banned user %s: %v", user.ID.Hex(), err)
+	}
+	ac.record(ctx, c, models.AuditUserBan, user, map[string]interface{}{
+		"reason": ban.Reason,
+		"until":  ban.Until,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "User banned",
+		"ban":     ban,
+	})
+}
+
+// Unban lifts a user's ban
+func (ac *AdminUserController) Unban(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findTarget(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if user.Ban == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is not banned",
+		})
+	}
+
+	if _, err := ac.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"ban": ""}}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unban user",
+		})
+	}
+	auth.Forget(user.ID)
+	ac.record(ctx, c, models.AuditUserUnban, user, map[string]interface{}{
+		"reason": user.Ban.Reason,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "User unbanned",
+	})
+}
+
+// SetHidden hides a user from the scoreboard, or shows them again
+func (ac *AdminUserController) SetHidden(c *fiber.Ctx) error {
+	var input struct {
+		Hidden *bool `json:"hidden"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Hidden == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "hidden is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findTarget(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	update := bson.M{"$unset": bson.M{"hidden": ""}}
+	action := models.AuditUserUnhide
+	if *input.Hidden {
+		update = bson.M{"$set": bson.M{"hidden": true}}
+		action = models.AuditUserHide
+	}
+	if _, err := ac.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+	ac.record(ctx, c, action, user, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "User updated",
+		"hidden":  *input.Hidden,
+	})
+}
+
+// SendPasswordReset emails the user a password reset link
+func (ac *AdminUserController) SendPasswordReset(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findTarget(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := sendPasswordReset(ctx, ac.resetCollection, ac.mailer, user); err != nil {
+		log.Printf("Error sending password reset to %s: %v", user.ID.Hex(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not send password reset",
+		})
+	}
+	ac.record(ctx, c, models.AuditUserPasswordReset, user, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset sent",
+	})
+}
+
+// ResetScore removes the user's solves, taking them off the scoreboard
+// until they solve again. Wrong attempts are kept.
+func (ac *AdminUserController) ResetScore(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findTarget(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	removed, points, err := ac.removeSubmissions(ctx, user.ID, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset score",
+		})
+	}
+	// Writeup bonuses stay, as they do on the scoreboard
+	_, err = ac.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{
+			"$inc": bson.M{"score": -points},
+			"$set": bson.M{"solvedChallenges": []models.SolvedChallenge{}},
+		},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset score",
+		})
+	}
+	ac.record(ctx, c, models.AuditUserScoreReset, user, map[string]interface{}{
+		"score":         user.Score,
+		"solvesRemoved": removed,
+	})
+
+	return c.JSON(fiber.Map{
+		"message":       "Score reset",
+		"solvesRemoved": removed,
+	})
+}
+
+// DeleteUser deletes a user for good, along with their submissions,
+// sessions, tokens and team membership
+func (ac *AdminUserController) DeleteUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, status, msg := ac.findOther(ctx, c)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if _, err := revokeSessions(ctx, ac.sessionCollection, ac.revokedCollection, bson.M{"user": user.ID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+	if _, err := ac.collection.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete user",
+		})
+	}
+	auth.Forget(user.ID)
+
+	// The account is gone; failures from here on leave orphans behind but
+	// cannot be undone, so they are logged rather than returned
+	removed, _, err := ac.removeSubmissions(ctx, user.ID, false)
+	if err != nil {
+		log.Printf("Error deleting submissions of user %s: %v", user.ID.Hex(), err)
+	}
+	ac.leaveTeam(ctx, user.ID)
+	for _, collection := range []*mongo.Collection{ac.sessionCollection, ac.tokenCollection, ac.resetCollection, ac.teamRequestCollection} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"user": user.ID}); err != nil {
+			log.Printf("Error deleting %s of user %s: %v", collection.Name(), user.ID.Hex(), err)
+		}
+	}
+	ac.record(ctx, c, models.AuditUserDelete, user, map[string]interface{}{
+		"email":              user.Email,
+		"submissionsRemoved": removed,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "User deleted",
+	})
+}
+
+// GetAuditLog lists recorded admin actions, newest first. target and
+// action narrow the list.
+func (ac *AdminUserController) GetAuditLog(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if target := c.Query("target"); target != "" {
+		targetID, err := primitive.ObjectIDFromHex(target)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid target ID",
+			})
+		}
+		filter["target"] = targetID
+	}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		value, lastID, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		filter["$or"] = cursorFilter("createdAt", time.UnixMilli(value), lastID, true)["$or"]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	limit := pageLimit(c)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+
+	cursor, err := ac.auditCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch audit log",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditLog{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode audit log",
+		})
+	}
+
+	nextCursor := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		nextCursor = encodeCursor(last.CreatedAt.UnixMilli(), last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"entries":    entries,
+		"nextCursor": nextCursor,
+	})
+}
+
+// findTarget loads the user named by the id parameter. On failure it
+// returns the status and message to answer with.
+func (ac *AdminUserController) findTarget(ctx context.Context, c *fiber.Ctx) (*models.User, int, string) {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "Invalid user ID"
+	}
+
+	var user models.User
+	err = ac.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.StatusNotFound, "User not found"
+	}
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "Failed to fetch user"
+	}
+	return &user, 0, ""
+}
+
+// findOther is findTarget for actions admins may not take on themselves,
+// so nobody locks themselves out by accident
+func (ac *AdminUserController) findOther(ctx context.Context, c *fiber.Ctx) (*models.User, int, string) {
+	user, status, msg := ac.findTarget(ctx, c)
+	if status == 0 && user.ID == auth.FromContext(c).ID() {
+		return nil, fiber.StatusBadRequest, "You cannot do this to your own account"
+	}
+	return user, status, msg
+}
+
+// record writes an audit log entry. A failure is logged, since the action
+// it describes has already happened.
+func (ac *AdminUserController) record(ctx context.Context, c *fiber.Ctx, action string, target *models.User, details map[string]interface{}) {
+	caller := auth.FromContext(c)
+	entry := models.AuditLog{
+		ActorID:    caller.ID(),
+		ActorName:  caller.Username,
+		Action:     action,
+		TargetID:   target.ID,
+		TargetName: target.Username,
+		Details:    details,
+	}
+	entry.BeforeCreate()
+	if _, err := ac.auditCollection.InsertOne(ctx, entry); err != nil {
+		log.Printf("Error writing audit log %s for %s: %v", action, target.ID.Hex(), err)
+	}
+}
+
+// removeSubmissions deletes a user's submissions, only the correct ones when
+// solvesOnly is set, and takes their solves back from challenge solve
+// counts and team scores. It returns how many submissions were deleted and
+// how many points the solves had awarded.
+func (ac *AdminUserController) removeSubmissions(ctx context.Context, userID primitive.ObjectID, solvesOnly bool) (int64, int, error) {
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := ac.submissionCollection.Find(ctx, bson.M{"user": userID, "isCorrect": true}, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	var solves []models.Submission
+	if err = cursor.All(ctx, &solves); err != nil {
+		return 0, 0, err
+	}
+
+	filter := bson.M{"user": userID}
+	if solvesOnly {
+		filter["isCorrect"] = true
+	}
+	result, err := ac.submissionCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	points := 0
+	for _, solve := range solves {
+		points += solve.PointsAwarded
+
+		_, err := ac.challengeCollection.UpdateOne(ctx,
+			bson.M{"_id": solve.ChallengeID, "solves": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"solves": -1}},
+		)
+		if err != nil {
+			log.Printf("Failed to uncount solve for challenge %s: %v", solve.ChallengeID.Hex(), err)
+		}
+
+		// The team keeps the points if a teammate solved it too; the
+		// earliest such solve takes over the credit
+		if solve.TeamID == nil || !solve.TeamCredit {
+			continue
+		}
+		err = ac.submissionCollection.FindOneAndUpdate(ctx,
+			bson.M{"team": solve.TeamID, "challenge": solve.ChallengeID, "isCorrect": true},
+			bson.M{"$set": bson.M{"teamCredit": true}},
+			options.FindOneAndUpdate().SetSort(bson.M{"createdAt": 1}),
+		).Err()
+		if err == nil {
+			continue
+		}
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Failed to move team credit for team %s: %v", solve.TeamID.Hex(), err)
+			continue
+		}
+		_, err = ac.teamCollection.UpdateOne(ctx,
+			bson.M{"_id": solve.TeamID},
+			bson.M{"$inc": bson.M{"score": -solve.PointsAwarded}, "$set": bson.M{"updatedAt": time.Now()}},
+		)
+		if err != nil {
+			log.Printf("Failed to update score for team %s: %v", solve.TeamID.Hex(), err)
+		}
+	}
+
+	return result.DeletedCount, points, nil
+}
+
+// leaveTeam takes a deleted user out of their team. A captain hands over to
+// the longest-standing member, and a team left empty is deleted.
+func (ac *AdminUserController) leaveTeam(ctx context.Context, userID primitive.ObjectID) {
+	var team models.Team
+	err := ac.teamCollection.FindOne(ctx, bson.M{"members": userID}).Decode(&team)
+	if err == mongo.ErrNoDocuments {
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding team of user %s: %v", userID.Hex(), err)
+		return
+	}
+
+	remaining := make([]primitive.ObjectID, 0, len(team.Members))
+	for _, member := range team.Members {
+		if member != userID {
+			remaining = append(remaining, member)
+		}
+	}
+
+	if len(remaining) == 0 {
+		_, err = ac.teamCollection.DeleteOne(ctx, bson.M{"_id": team.ID})
+	} else {
+		set := bson.M{"updatedAt": time.Now()}
+		if team.CaptainID == userID {
+			set["captain"] = remaining[0]
+		}
+		_, err = ac.teamCollection.UpdateOne(ctx, bson.M{"_id": team.ID}, bson.M{
+			"$pull": bson.M{"members": userID},
+			"$set":  set,
+		})
+	}
+	if err != nil {
+		log.Printf("Error removing user %s from team %s: %v", userID.Hex(), team.ID.Hex(), err)
+	}
+}
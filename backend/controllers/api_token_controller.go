@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/models"
+)
+
+// maxAPITokens limits how many active tokens a user can hold
+const maxAPITokens = 20
+
+// APITokenController lets users manage personal API tokens for scripts.
+// The token itself is shown once at creation; afterwards only its prefix,
+// scopes and usage are visible.
+type APITokenController struct {
+	collection *mongo.Collection
+}
+
+func NewAPITokenController(db *mongo.Database) *APITokenController {
+	return &APITokenController{
+		collection: db.Collection("api_tokens"),
+	}
+}
+
+// GetMyTokens lists the current user's tokens with their last use and
+// usage count
+func (ac *APITokenController) GetMyTokens(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := ac.collection.Find(ctx, bson.M{"user": auth.FromContext(c).ID()}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tokens",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.APIToken{}
+	if err = cursor.All(ctx, &tokens); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode tokens",
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
+// CreateToken issues a named, scoped token with an optional expiry
+func (ac *APITokenController) CreateToken(c *fiber.Ctx) error {
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > 50 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name is required and must be at most 50 characters",
+		})
+	}
+	scopes, ok := normalizeScopes(input.Scopes)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "scopes must be a non-empty list of known scopes",
+			"scopes": models.APITokenScopes,
+		})
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expiresAt must be in the future",
+		})
+	}
+
+	userID := auth.FromContext(c).ID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	active, err := ac.collection.CountDocuments(ctx, bson.M{
+		"user":      userID,
+		"revokedAt": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$exists": false}},
+			bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+		},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count tokens",
+		})
+	}
+	if active >= maxAPITokens {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Too many active tokens, revoke one first",
+		})
+	}
+
+	secret, err := randomToken(24)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate token",
+		})
+	}
+	raw := auth.APITokenPrefix + secret
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      input.Name,
+		Prefix:    raw[:len(auth.APITokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+	token.BeforeCreate()
+
+	result, err := ac.collection.InsertOne(ctx, token)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create token",
+		})
+	}
+	token.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":    raw,
+		"apiToken": token,
+	})
+}
+
+// RevokeToken revokes one of the current user's tokens
+func (ac *APITokenController) RevokeToken(c *fiber.Ctx) error {
+	tokenID, err := primitive.ObjectIDFromHex(c.Params("tokenId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid token ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := ac.collection.UpdateOne(ctx,
+		bson.M{"_id": tokenID, "user": auth.FromContext(c).ID(), "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not revoke token",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Token not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Token revoked",
+	})
+}
+
+// normalizeScopes deduplicates scopes and checks they are all known
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, scope := range scopes {
+		known := false
+		for _, valid := range models.APITokenScopes {
+			if scope == valid {
+				known = true
+			}
+		}
+		if !known {
+			return nil, false
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, len(result) > 0
+}
@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/models"
+)
+
+type BracketController struct {
+	collection     *mongo.Collection
+	userCollection *mongo.Collection
+	teamCollection *mongo.Collection
+}
+
+func NewBracketController(db *mongo.Database) *BracketController {
+	return &BracketController{
+		collection:     db.Collection("brackets"),
+		userCollection: db.Collection("users"),
+		teamCollection: db.Collection("teams"),
+	}
+}
+
+func (bc *BracketController) GetAllBrackets(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := bc.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch brackets",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	brackets := []models.Bracket{}
+	if err = cursor.All(ctx, &brackets); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode brackets",
+		})
+	}
+
+	return c.JSON(brackets)
+}
+
+func (bc *BracketController) CreateBracket(c *fiber.Ctx) error {
+	var bracket models.Bracket
+	if err := c.BodyParser(&bracket); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if err := bracket.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	bracket.ID = primitive.NilObjectID
+	bracket.BeforeCreate()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := bc.collection.InsertOne(ctx, bracket)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A bracket with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create bracket",
+		})
+	}
+	bracket.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(bracket)
+}
+
+func (bc *BracketController) UpdateBracket(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bracket ID",
+		})
+	}
+
+	var input models.Bracket
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := bc.collection.UpdateOne(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{
+			"name":                 input.Name,
+			"description":          input.Description,
+			"requiresVerification": input.RequiresVerification,
+			"order":                input.Order,
+			"updatedAt":            time.Now(),
+		}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A bracket with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update bracket",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bracket not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Bracket updated successfully",
+	})
+}
+
+// DeleteBracket removes a bracket nobody is registered in
+func (bc *BracketController) DeleteBracket(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bracket ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	users, err := bc.userCollection.CountDocuments(ctx, bson.M{"bracket.id": objID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete bracket",
+		})
+	}
+	teams, err := bc.teamCollection.CountDocuments(ctx, bson.M{"bracket.id": objID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete bracket",
+		})
+	}
+	if users+teams > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Bracket still has users or teams",
+			"users": users,
+			"teams": teams,
+		})
+	}
+
+	result, err := bc.collection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete bracket",
+		})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bracket not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Bracket deleted successfully",
+	})
+}
+
+// GetPendingVerifications lists the users and teams waiting for an admin to
+// verify their bracket.
+func (bc *BracketController) GetPendingVerifications(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bracket ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"bracket.id": objID, "bracket.verified": false}
+
+	var users []models.User
+	cursor, err := bc.userCollection.Find(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch pending users",
+		})
+	}
+	if err = cursor.All(ctx, &users); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode pending users",
+		})
+	}
+
+	var teams []models.Team
+	cursor, err = bc.teamCollection.Find(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch pending teams",
+		})
+	}
+	if err = cursor.All(ctx, &teams); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode pending teams",
+		})
+	}
+
+	publicUsers := make([]models.PublicUser, 0, len(users))
+	for i := range users {
+		publicUsers = append(publicUsers, users[i].Public())
+	}
+	publicTeams := make([]models.PublicTeam, 0, len(teams))
+	for i := range teams {
+		publicTeams = append(publicTeams, teams[i].Public(nil))
+	}
+
+	return c.JSON(fiber.Map{
+		"users": publicUsers,
+		"teams": publicTeams,
+	})
+}
+
+// SetUserBracket places a user in the bracket and sets its verification
+func (bc *BracketController) SetUserBracket(c *fiber.Ctx) error {
+	return bc.setMembership(c, bc.userCollection, c.Params("userId"), "User")
+}
+
+// SetTeamBracket places a team in the bracket and sets its verification
+func (bc *BracketController) SetTeamBracket(c *fiber.Ctx) error {
+	return bc.setMembership(c, bc.teamCollection, c.Params("teamId"), "Team")
+}
+
+func (bc *BracketController) setMembership(c *fiber.Ctx, collection *mongo.Collection, rawID, kind string) error {
+	bracketID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bracket ID",
+		})
+	}
+	objID, err := primitive.ObjectIDFromHex(rawID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid " + kind + " ID",
+		})
+	}
+
+	input := struct {
+		Verified bool `json:"verified"`
+	}{Verified: true}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := bc.collection.FindOne(ctx, bson.M{"_id": bracketID}).Err(); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bracket not found",
+		})
+	}
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"bracket": models.BracketMembership{BracketID: bracketID, Verified: input.Verified}}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update bracket",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": kind + " not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": kind + " bracket updated",
+	})
+}
+
+// resolveBracket turns a bracket ID picked at registration into a
+// membership. Brackets that need verification start unverified.
+func resolveBracket(ctx context.Context, brackets *mongo.Collection, rawID string) (*models.BracketMembership, error) {
+	if rawID == "" {
+		return nil, nil
+	}
+	objID, err := primitive.ObjectIDFromHex(rawID)
+	if err != nil {
+		return nil, errors.New("invalid bracket ID")
+	}
+
+	var bracket models.Bracket
+	if err := brackets.FindOne(ctx, bson.M{"_id": objID}).Decode(&bracket); err != nil {
+		return nil, errors.New("bracket not found")
+	}
+	return &models.BracketMembership{
+		BracketID: bracket.ID,
+		Verified:  !bracket.RequiresVerification,
+	}, nil
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/models"
+)
+
+type CategoryController struct {
+	collection          *mongo.Collection
+	challengeCollection *mongo.Collection
+	revisionCollection  *mongo.Collection
+}
+
+func NewCategoryController(db *mongo.Database) *CategoryController {
+	return &CategoryController{
+		collection:          db.Collection("categories"),
+		challengeCollection: db.Collection("challenges"),
+		revisionCollection:  db.Collection("challenge_revisions"),
+	}
+}
+
+// GetAllCategories lists categories in display order
+func (cat *CategoryController) GetAllCategories(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := cat.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch categories",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	categories := []models.Category{}
+	if err = cursor.All(ctx, &categories); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode categories",
+		})
+	}
+
+	return c.JSON(categories)
+}
+
+func (cat *CategoryController) CreateCategory(c *fiber.Ctx) error {
+	var category models.Category
+	if err := c.BodyParser(&category); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if err := category.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	category.ID = primitive.NilObjectID
+	category.BeforeCreate()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := cat.collection.InsertOne(ctx, category)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A category with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create category",
+		})
+	}
+	category.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// UpdateCategory replaces a category's fields. Renaming it also renames the
+// category on every challenge that uses it.
+func (cat *CategoryController) UpdateCategory(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category ID",
+		})
+	}
+
+	var input models.Category
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var before models.Category
+	err = cat.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{
+			"name":        input.Name,
+			"description": input.Description,
+			"color":       input.Color,
+			"order":       input.Order,
+			"updatedAt":   time.Now(),
+		}},
+	).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category not found",
+			})
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A category with this name already exists",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update category",
+		})
+	}
+
+	// Challenges are renamed one at a time so each gets a new updatedAt,
+	// which invalidates ETags held by editors, and a revision
+	var renamed int64
+	for before.Name != input.Name {
+		var challenge models.Challenge
+		err := cat.challengeCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"category": before.Name},
+			bson.M{"$set": bson.M{
+				"category":  input.Name,
+				"updatedAt": time.Now().Truncate(time.Millisecond),
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&challenge)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Category renamed but challenges could not be updated",
+			})
+		}
+		renamed++
+
+		previous := challenge.Clone()
+		previous.Category = before.Name
+		insertRevision(ctx, cat.revisionCollection, auth.FromContext(c).ID(), models.RevisionUpdate, &previous, &challenge, nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":           "Category updated successfully",
+		"challengesRenamed": renamed,
+	})
+}
+
+// DeleteCategory removes a category that no challenge uses any more
+func (cat *CategoryController) DeleteCategory(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var category models.Category
+	err = cat.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch category",
+		})
+	}
+
+	inUse, err := cat.challengeCollection.CountDocuments(ctx, bson.M{"category": category.Name})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete category",
+		})
+	}
+	if inUse > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":      "Category is still used by challenges",
+			"challenges": inUse,
+		})
+	}
+
+	if _, err := cat.collection.DeleteOne(ctx, bson.M{"_id": objID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete category",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Category deleted successfully",
+	})
+}
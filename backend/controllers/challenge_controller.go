@@ -2,32 +2,156 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"ctf-backend/auth"
+	"ctf-backend/config"
 	"ctf-backend/models"
 )
 
 type ChallengeController struct {
-	collection *mongo.Collection
+	collection           *mongo.Collection
+	submissionCollection *mongo.Collection
+	revisionCollection   *mongo.Collection
+	categoryCollection   *mongo.Collection
+	userCollection       *mongo.Collection
+	teamCollection       *mongo.Collection
 }
 
 func NewChallengeController(db *mongo.Database) *ChallengeController {
 	return &ChallengeController{
-		collection: db.Collection("challenges"),
+		collection:           db.Collection("challenges"),
+		submissionCollection: db.Collection("submissions"),
+		revisionCollection:   db.Collection("challenge_revisions"),
+		categoryCollection:   db.Collection("categories"),
+		userCollection:       db.Collection("users"),
+		teamCollection:       db.Collection("teams"),
 	}
 }
 
+// challengeSortFields maps the sort query parameter to the field it orders by
+var challengeSortFields = map[string]string{
+	"points": "points",
+	"solves": "solves",
+	"newest": "createdAt",
+}
+
+// GetAllChallenges lists active challenges. Supported query parameters:
+// category, difficulty, tag (comma separated, all must match), status
+// (solved|unsolved, needs a token), q (text search over title and
+// description), sort (points|solves|newest), order
+// (asc|desc), limit and cursor (from nextCursor of the previous page).
 func (cc *ChallengeController) GetAllChallenges(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	filter := models.PublishedFilter()
+	if category := c.Query("category"); category != "" {
+		filter["category"] = category
+	}
+	if difficulty := c.Query("difficulty"); difficulty != "" {
+		filter["difficulty"] = difficulty
+	}
+	if tagList := c.Query("tag"); tagList != "" {
+		tags, err := models.NormalizeTags(strings.Split(tagList, ","))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if len(tags) > 0 {
+			filter["tags"] = bson.M{"$all": tags}
+		}
+	}
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		filter["$text"] = bson.M{"$search": search}
+	}
+
+	if status := c.Query("status"); status != "" {
+		if status != "solved" && status != "unsolved" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "status must be solved or unsolved",
+			})
+		}
+		caller := auth.FromContext(c)
+		if caller == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Login required to filter by solved status",
+			})
+		}
+		userObjID := caller.UserID
+
+		solved, err := cc.submissionCollection.Distinct(ctx, "challenge", bson.M{
+			"user":      userObjID,
+			"isCorrect": true,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch challenges",
+			})
+		}
+		if solved == nil {
+			solved = []interface{}{}
+		}
+		if status == "solved" {
+			filter["_id"] = bson.M{"$in": solved}
+		} else {
+			filter["_id"] = bson.M{"$nin": solved}
+		}
+	}
+
+	sortKey := c.Query("sort", "points")
+	sortField, ok := challengeSortFields[sortKey]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be one of points, solves or newest",
+		})
+	}
+	// The stored counter includes solves the freeze hides
+	if sortField == "solves" && scoreboardCutoff(c) != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sorting by solves is unavailable while the scoreboard is frozen",
+		})
+	}
+	descending := c.Query("order", "desc") != "asc"
+	direction := 1
+	if descending {
+		direction = -1
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		value, lastID, err := decodeCursor(cursor)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		var sortValue interface{} = value
+		if sortField == "createdAt" {
+			sortValue = time.UnixMilli(value)
+		}
+		filter["$or"] = cursorFilter(sortField, sortValue, lastID, descending)["$or"]
+	}
+
+	limit := pageLimit(c)
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(limit + 1))
+
 	var challenges []models.Challenge
-	cursor, err := cc.collection.Find(ctx, bson.M{"isActive": true})
+	cursor, err := cc.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch challenges",
@@ -41,7 +165,34 @@ func (cc *ChallengeController) GetAllChallenges(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(challenges)
+	nextCursor := ""
+	if len(challenges) > limit {
+		challenges = challenges[:limit]
+		last := challenges[limit-1]
+		var value int64
+		switch sortField {
+		case "points":
+			value = int64(last.Points)
+		case "solves":
+			value = int64(last.Solves)
+		case "createdAt":
+			value = last.CreatedAt.UnixMilli()
+		}
+		nextCursor = encodeCursor(value, last.ID)
+	}
+	if challenges == nil {
+		challenges = []models.Challenge{}
+	}
+	if err = cc.publicSolveCounts(ctx, c, challenges); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count solves",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"challenges": challenges,
+		"nextCursor": nextCursor,
+	})
 }
 
 func (cc *ChallengeController) GetChallengeByID(c *fiber.Ctx) error {
@@ -69,27 +220,79 @@ func (cc *ChallengeController) GetChallengeByID(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(challenge)
+	// Unpublished challenges are only visible to their author and admins
+	if !challenge.IsPublished() && !canManageChallenge(c, &challenge) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Challenge not found",
+		})
+	}
+
+	counted := []models.Challenge{challenge}
+	if err = cc.publicSolveCounts(ctx, c, counted); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count solves",
+		})
+	}
+
+	c.Set(fiber.HeaderETag, challenge.ETag())
+	return c.JSON(counted[0])
 }
 
+// CreateChallenge takes the same editable fields as UpdateChallenge. Authors
+// always start in draft; admins publish directly unless they ask for a
+// draft.
 func (cc *ChallengeController) CreateChallenge(c *fiber.Ctx) error {
-	var challenge models.Challenge
-
-	if err := c.BodyParser(&challenge); err != nil {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
+	var asDraft bool
+	if raw, ok := body["status"]; ok {
+		var status string
+		if err := json.Unmarshal(raw, &status); err != nil || (status != models.ChallengeDraft && status != models.ChallengePublished) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "status must be draft or published",
+			})
+		}
+		asDraft = status == models.ChallengeDraft
+		delete(body, "status")
+	}
+
 	// Set default values
-	challenge.IsActive = true
-	challenge.CreatedAt = time.Now()
-	challenge.UpdatedAt = time.Now()
+	challenge := models.Challenge{IsActive: true}
+	if _, _, err := challenge.ApplyPatch(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := challenge.Validate(); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userID, isAdmin := challengeCaller(c)
+	challenge.AuthorID = userID
+	challenge.Status = models.ChallengePublished
+	if !isAdmin || asDraft {
+		challenge.Status = models.ChallengeDraft
+	}
+	challenge.CreatedAt = time.Now().Truncate(time.Millisecond)
+	challenge.UpdatedAt = challenge.CreatedAt
 
 	// Insert into database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := cc.checkCategory(ctx, challenge.Category); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	result, err := cc.collection.InsertOne(ctx, challenge)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -98,10 +301,16 @@ func (cc *ChallengeController) CreateChallenge(c *fiber.Ctx) error {
 	}
 
 	challenge.ID = result.InsertedID.(primitive.ObjectID)
+	cc.recordRevision(ctx, c, models.RevisionCreate, nil, &challenge, nil)
 
+	c.Set(fiber.HeaderETag, challenge.ETag())
 	return c.Status(fiber.StatusCreated).JSON(challenge)
 }
 
+// UpdateChallenge applies a JSON Merge Patch restricted to the editable
+// challenge fields. If the client sends If-Match, it must equal the current
+// ETag; the write itself is conditional on updatedAt so concurrent edits
+// are never silently overwritten.
 func (cc *ChallengeController) UpdateChallenge(c *fiber.Ctx) error {
 	id := c.Params("id")
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -111,24 +320,81 @@ func (cc *ChallengeController) UpdateChallenge(c *fiber.Ctx) error {
 		})
 	}
 
-	var updateData map[string]interface{}
-	if err := c.BodyParser(&updateData); err != nil {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
-	// Update the updatedAt field
-	updateData["updatedAt"] = time.Now()
-
-	// Update in database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	var challenge models.Challenge
+	err = cc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	if _, isAdmin := challengeCaller(c); !isAdmin {
+		if !canManageChallenge(c, &challenge) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You can only edit your own challenges",
+			})
+		}
+		if challenge.Status != models.ChallengeDraft {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Only draft challenges can be edited by authors",
+			})
+		}
+	}
+
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" && ifMatch != challenge.ETag() {
+		c.Set(fiber.HeaderETag, challenge.ETag())
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "Challenge was modified by someone else, reload and try again",
+		})
+	}
+
+	before := challenge.Clone()
+	set, unset, err := challenge.ApplyPatch(patch)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := challenge.Validate(); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if challenge.Category != before.Category {
+		if err := cc.checkCategory(ctx, challenge.Category); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// Mongo stores milliseconds, keep the ETag stable across a round trip
+	challenge.UpdatedAt = time.Now().Truncate(time.Millisecond)
+	set["updatedAt"] = challenge.UpdatedAt
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
 	result, err := cc.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": objID},
-		bson.M{"$set": updateData},
+		bson.M{"_id": objID, "updatedAt": before.UpdatedAt},
+		update,
 	)
 
 	if err != nil {
@@ -138,13 +404,17 @@ func (cc *ChallengeController) UpdateChallenge(c *fiber.Ctx) error {
 	}
 
 	if result.MatchedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Challenge not found",
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "Challenge was modified by someone else, reload and try again",
 		})
 	}
 
+	cc.recordRevision(ctx, c, models.RevisionUpdate, &before, &challenge, nil)
+
+	c.Set(fiber.HeaderETag, challenge.ETag())
 	return c.JSON(fiber.Map{
-		"message": "Challenge updated successfully",
+		"message":   "Challenge updated successfully",
+		"challenge": challenge,
 	})
 }
 
@@ -161,25 +431,671 @@ func (cc *ChallengeController) DeleteChallenge(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := cc.collection.UpdateOne(
+	var before models.Challenge
+	now := time.Now().Truncate(time.Millisecond)
+	err = cc.collection.FindOneAndUpdate(
 		ctx,
 		bson.M{"_id": objID},
-		bson.M{"$set": bson.M{"isActive": false, "updatedAt": time.Now()}},
-	)
+		bson.M{"$set": bson.M{"isActive": false, "updatedAt": now}},
+	).Decode(&before)
 
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete challenge",
 		})
 	}
 
+	after := before.Clone()
+	after.IsActive = false
+	after.UpdatedAt = now
+	cc.recordRevision(ctx, c, models.RevisionDelete, &before, &after, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Challenge deleted successfully",
+	})
+}
+
+// GetChallengeRevisions lists the revisions of a challenge, newest first
+func (cc *ChallengeController) GetChallengeRevisions(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := cc.revisionCollection.Find(ctx, bson.M{"challenge": objID}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch revisions",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.ChallengeRevision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode revisions",
+		})
+	}
+
+	return c.JSON(revisions)
+}
+
+// RollbackChallenge restores the editable fields of a challenge from one of
+// its revisions. The rollback is itself recorded as a new revision, and it
+// honours If-Match the same way UpdateChallenge does.
+func (cc *ChallengeController) RollbackChallenge(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+	revisionID, err := primitive.ObjectIDFromHex(c.Params("revisionId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid revision ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var revision models.ChallengeRevision
+	err = cc.revisionCollection.FindOne(ctx, bson.M{"_id": revisionID, "challenge": objID}).Decode(&revision)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Revision not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch revision",
+		})
+	}
+
+	var current models.Challenge
+	err = cc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&current)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" && ifMatch != current.ETag() {
+		c.Set(fiber.HeaderETag, current.ETag())
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "Challenge was modified by someone else, reload and try again",
+		})
+	}
+
+	// Keep identity, authorship and solve counts, restore everything editable
+	restored := revision.Snapshot.Clone()
+	restored.ID = current.ID
+	restored.AuthorID = current.AuthorID
+	restored.Solves = current.Solves
+	restored.CreatedAt = current.CreatedAt
+	restored.UpdatedAt = time.Now().Truncate(time.Millisecond)
+
+	// Categories renamed since the revision keep their current name
+	if restored.Category != current.Category && cc.checkCategory(ctx, restored.Category) != nil {
+		restored.Category = current.Category
+	}
+
+	set, unset := restored.EditableUpdate()
+	set["updatedAt"] = restored.UpdatedAt
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := cc.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objID, "updatedAt": current.UpdatedAt},
+		update,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to roll back challenge",
+		})
+	}
 	if result.MatchedCount == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Challenge not found",
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "Challenge was modified by someone else, reload and try again",
 		})
 	}
 
+	cc.recordRevision(ctx, c, models.RevisionRollback, &current, &restored, &revision.ID)
+
+	c.Set(fiber.HeaderETag, restored.ETag())
 	return c.JSON(fiber.Map{
-		"message": "Challenge deleted successfully",
+		"message":   "Challenge rolled back successfully",
+		"challenge": restored,
 	})
 }
+
+// GetChallengeSolves lists who solved a challenge, in solve order. With
+// by=team each team is ranked by its first solve. Hidden accounts are left
+// out, and solves after the scoreboard freeze are only shown to admins.
+func (cc *ChallengeController) GetChallengeSolves(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+	byTeam := c.Query("by") == "team"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var challenge models.Challenge
+	err = cc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&challenge)
+	if err != nil || (!challenge.IsPublished() && !canManageChallenge(c, &challenge)) {
+		if err == nil || err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	match := bson.M{"challenge": objID, "isCorrect": true}
+	_, isAdmin := challengeCaller(c)
+	frozen := false
+	if freeze, ok := config.ScoreboardFreeze(); ok && !isAdmin && time.Now().After(freeze) {
+		match["createdAt"] = bson.M{"$lte": freeze}
+		frozen = true
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "users",
+			"localField":   "user",
+			"foreignField": "_id",
+			"as":           "account",
+		}}},
+		bson.D{{Key: "$unwind", Value: "$account"}},
+		bson.D{{Key: "$match", Value: bson.M{"account.hidden": bson.M{"$ne": true}}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"user":      1,
+			"createdAt": 1,
+			"username":  "$account.username",
+		}}},
+	}
+
+	cursor, err := cc.submissionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch solves",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		UserID   primitive.ObjectID `bson:"user"`
+		Username string             `bson:"username"`
+		SolvedAt time.Time          `bson:"createdAt"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode solves",
+		})
+	}
+
+	var teamOf map[primitive.ObjectID]models.Team
+	if byTeam {
+		userIDs := make([]primitive.ObjectID, 0, len(rows))
+		for _, row := range rows {
+			userIDs = append(userIDs, row.UserID)
+		}
+		teamOf, err = cc.teamsByMember(ctx, userIDs)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch teams",
+			})
+		}
+	}
+
+	solves := []models.Solve{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, row := range rows {
+		solve := models.Solve{SolvedAt: row.SolvedAt}
+		key := row.UserID
+		if byTeam {
+			team, ok := teamOf[row.UserID]
+			if !ok {
+				continue
+			}
+			key = team.ID
+			teamID := team.ID
+			solve.TeamID = &teamID
+			solve.TeamName = team.Name
+		} else {
+			userID := row.UserID
+			solve.UserID = &userID
+			solve.Username = row.Username
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		solve.Rank = len(solves) + 1
+		solves = append(solves, solve)
+	}
+
+	return c.JSON(fiber.Map{
+		"challengeId": objID,
+		"frozen":      frozen,
+		"solves":      solves,
+	})
+}
+
+// GetChallengeSolveStats reports attempts, solve rate and time-to-solve for
+// a challenge (admin view). Time-to-solve runs from a player's first
+// submission to their correct one.
+func (cc *ChallengeController) GetChallengeSolveStats(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"challenge": objID}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":          "$user",
+			"attempts":     bson.M{"$sum": 1},
+			"wrong":        bson.M{"$sum": bson.M{"$cond": bson.A{"$isCorrect", 0, 1}}},
+			"firstAttempt": bson.M{"$min": "$createdAt"},
+			"solvedAt":     bson.M{"$min": bson.M{"$cond": bson.A{"$isCorrect", "$createdAt", nil}}},
+		}}},
+	}
+
+	cursor, err := cc.submissionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute statistics",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var players []struct {
+		Attempts     int64      `bson:"attempts"`
+		Wrong        int64      `bson:"wrong"`
+		FirstAttempt time.Time  `bson:"firstAttempt"`
+		SolvedAt     *time.Time `bson:"solvedAt"`
+	}
+	if err = cursor.All(ctx, &players); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode statistics",
+		})
+	}
+
+	stats := models.SolveStats{Attempters: len(players)}
+	var durations []float64
+	var wrongBeforeSolve int64
+	for _, player := range players {
+		stats.Attempts += player.Attempts
+		if player.SolvedAt == nil {
+			continue
+		}
+		stats.Solvers++
+		wrongBeforeSolve += player.Wrong
+		durations = append(durations, player.SolvedAt.Sub(player.FirstAttempt).Seconds())
+	}
+	if stats.Attempters > 0 {
+		stats.SolveRate = float64(stats.Solvers) / float64(stats.Attempters)
+	}
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		median := durations[len(durations)/2]
+		if len(durations)%2 == 0 {
+			median = (durations[len(durations)/2-1] + median) / 2
+		}
+		stats.MedianTimeToSolve = &median
+		average := float64(wrongBeforeSolve) / float64(stats.Solvers)
+		stats.AttemptsBeforeSolveAvg = &average
+	}
+
+	return c.JSON(stats)
+}
+
+// teamsByMember maps each of the given users to the team they belong to
+func (cc *ChallengeController) teamsByMember(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]models.Team, error) {
+	teamOf := map[primitive.ObjectID]models.Team{}
+	if len(userIDs) == 0 {
+		return teamOf, nil
+	}
+
+	cursor, err := cc.teamCollection.Find(ctx, bson.M{"members": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var teams []models.Team
+	if err = cursor.All(ctx, &teams); err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		for _, member := range team.Members {
+			teamOf[member] = team
+		}
+	}
+	return teamOf, nil
+}
+
+// publicSolveCounts replaces the stored solve counters with what the solver
+// list shows the caller: hidden accounts are left out, and after the
+// scoreboard freeze so are later solves. Admins see the stored counters.
+func (cc *ChallengeController) publicSolveCounts(ctx context.Context, c *fiber.Ctx, challenges []models.Challenge) error {
+	if _, isAdmin := challengeCaller(c); isAdmin || len(challenges) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(challenges))
+	for _, challenge := range challenges {
+		ids = append(ids, challenge.ID)
+	}
+	match := bson.M{"challenge": bson.M{"$in": ids}, "isCorrect": true}
+	if cutoff := scoreboardCutoff(c); cutoff != nil {
+		match["createdAt"] = bson.M{"$lte": *cutoff}
+	}
+
+	cursor, err := cc.submissionCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "users",
+			"localField":   "user",
+			"foreignField": "_id",
+			"as":           "account",
+		}}},
+		bson.D{{Key: "$unwind", Value: "$account"}},
+		bson.D{{Key: "$match", Value: bson.M{"account.hidden": bson.M{"$ne": true}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$challenge", "solves": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		Solves int                `bson:"solves"`
+	}
+	if err = cursor.All(ctx, &counts); err != nil {
+		return err
+	}
+
+	solves := map[primitive.ObjectID]int{}
+	for _, count := range counts {
+		solves[count.ID] = count.Solves
+	}
+	for i := range challenges {
+		challenges[i].Solves = solves[challenges[i].ID]
+	}
+	return nil
+}
+
+// checkCategory verifies that name is one of the admin-managed categories
+func (cc *ChallengeController) checkCategory(ctx context.Context, name string) error {
+	count, err := cc.categoryCollection.CountDocuments(ctx, bson.M{"name": name})
+	if err != nil {
+		return errors.New("failed to check category")
+	}
+	if count == 0 {
+		return fmt.Errorf("unknown category %q", name)
+	}
+	return nil
+}
+
+// recordRevision stores an immutable revision for a change that has already
+// been written. A failure here is logged but does not undo the change.
+func (cc *ChallengeController) recordRevision(ctx context.Context, c *fiber.Ctx, action string, before, after *models.Challenge, rolledBackFrom *primitive.ObjectID) {
+	insertRevision(ctx, cc.revisionCollection, auth.FromContext(c).ID(), action, before, after, rolledBackFrom)
+}
+
+// insertRevision is recordRevision for callers outside ChallengeController
+func insertRevision(ctx context.Context, revisions *mongo.Collection, authorID primitive.ObjectID, action string, before, after *models.Challenge, rolledBackFrom *primitive.ObjectID) {
+	revision := models.ChallengeRevision{
+		ChallengeID:    after.ID,
+		Action:         action,
+		AuthorID:       authorID,
+		Diff:           models.DiffChallenges(before, after),
+		Snapshot:       after.Clone(),
+		RolledBackFrom: rolledBackFrom,
+	}
+	revision.BeforeCreate()
+
+	if _, err := revisions.InsertOne(ctx, revision); err != nil {
+		log.Printf("Failed to record %s revision for challenge %s: %v", action, after.ID.Hex(), err)
+	}
+}
+
+// GetAuthoredChallenges lists the caller's own challenges in every state.
+// Admins see every unpublished challenge instead.
+func (cc *ChallengeController) GetAuthoredChallenges(c *fiber.Ctx) error {
+	userID, isAdmin := challengeCaller(c)
+
+	filter := bson.M{"author": userID}
+	if isAdmin {
+		filter = bson.M{"status": bson.M{"$in": bson.A{models.ChallengeDraft, models.ChallengeReview}}}
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+	cursor, err := cc.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenges",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	challenges := []models.Challenge{}
+	if err = cursor.All(ctx, &challenges); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode challenges",
+		})
+	}
+
+	return c.JSON(challenges)
+}
+
+// SubmitChallengeForReview moves the caller's draft into review
+func (cc *ChallengeController) SubmitChallengeForReview(c *fiber.Ctx) error {
+	return cc.transitionChallenge(c, models.ChallengeDraft, models.ChallengeReview, func(challenge *models.Challenge) (int, string) {
+		if !canManageChallenge(c, challenge) {
+			return fiber.StatusForbidden, "You can only submit your own challenges"
+		}
+		return 0, ""
+	})
+}
+
+// ApproveChallenge publishes a challenge under review. The reviewer must be
+// someone other than the author.
+func (cc *ChallengeController) ApproveChallenge(c *fiber.Ctx) error {
+	return cc.transitionChallenge(c, models.ChallengeReview, models.ChallengePublished, reviewerCheck(c))
+}
+
+// RejectChallenge sends a challenge under review back to draft with an
+// optional note for the author.
+func (cc *ChallengeController) RejectChallenge(c *fiber.Ctx) error {
+	return cc.transitionChallenge(c, models.ChallengeReview, models.ChallengeDraft, reviewerCheck(c))
+}
+
+// TestSolveChallenge checks a flag against a challenge without recording a
+// submission, so authors can verify unpublished challenges.
+func (cc *ChallengeController) TestSolveChallenge(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+
+	var input struct {
+		Flag string `json:"flag"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var challenge models.Challenge
+	err = cc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	if !canManageChallenge(c, &challenge) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only test your own challenges",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"correct": input.Flag == challenge.Flag,
+		"counted": false,
+	})
+}
+
+// transitionChallenge moves a challenge from one workflow state to another.
+// check may refuse the transition by returning a status code and message.
+func (cc *ChallengeController) transitionChallenge(c *fiber.Ctx, from, to string, check func(*models.Challenge) (int, string)) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+
+	var input struct {
+		Note string `json:"note"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var challenge models.Challenge
+	err = cc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	if status, message := check(&challenge); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	before := challenge.Clone()
+	challenge.Status = to
+	challenge.ReviewNote = input.Note
+	challenge.UpdatedAt = time.Now().Truncate(time.Millisecond)
+	set := bson.M{"status": to, "reviewNote": input.Note, "updatedAt": challenge.UpdatedAt}
+	if from == models.ChallengeReview {
+		reviewerID, _ := challengeCaller(c)
+		challenge.ReviewerID = &reviewerID
+		set["reviewer"] = reviewerID
+	}
+
+	result, err := cc.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objID, "status": from},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update challenge",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Challenge is not in " + from,
+		})
+	}
+
+	cc.recordRevision(ctx, c, models.RevisionUpdate, &before, &challenge, nil)
+
+	c.Set(fiber.HeaderETag, challenge.ETag())
+	return c.JSON(fiber.Map{
+		"message":   "Challenge moved to " + to,
+		"challenge": challenge,
+	})
+}
+
+// reviewerCheck refuses reviews of the caller's own challenge
+func reviewerCheck(c *fiber.Ctx) func(*models.Challenge) (int, string) {
+	return func(challenge *models.Challenge) (int, string) {
+		userID, _ := challengeCaller(c)
+		if challenge.AuthorID == userID {
+			return fiber.StatusForbidden, "A challenge must be reviewed by someone other than its author"
+		}
+		return 0, ""
+	}
+}
+
+// challengeCaller returns the authenticated user and whether they are admin
+func challengeCaller(c *fiber.Ctx) (primitive.ObjectID, bool) {
+	caller := auth.FromContext(c)
+	return caller.ID(), caller.IsAdmin()
+}
+
+// canManageChallenge reports whether the caller is an admin or the author
+func canManageChallenge(c *fiber.Ctx, challenge *models.Challenge) bool {
+	userID, isAdmin := challengeCaller(c)
+	return isAdmin || (!userID.IsZero() && challenge.AuthorID == userID)
+}
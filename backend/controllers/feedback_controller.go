@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/models"
+)
+
+const defaultFeedbackMinAttempts = 5
+
+type FeedbackController struct {
+	collection           *mongo.Collection
+	challengeCollection  *mongo.Collection
+	submissionCollection *mongo.Collection
+}
+
+func NewFeedbackController(db *mongo.Database) *FeedbackController {
+	return &FeedbackController{
+		collection:           db.Collection("feedback"),
+		challengeCollection:  db.Collection("challenges"),
+		submissionCollection: db.Collection("submissions"),
+	}
+}
+
+// SubmitFeedback rates a challenge. Players may rate once they solved it or
+// after FEEDBACK_MIN_ATTEMPTS submissions; rating again replaces the
+// previous feedback.
+func (fc *FeedbackController) SubmitFeedback(c *fiber.Ctx) error {
+	challengeID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+	userID, _ := challengeCaller(c)
+
+	var feedback models.Feedback
+	if err := c.BodyParser(&feedback); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if err := feedback.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := models.PublishedFilter()
+	filter["_id"] = challengeID
+	if err := fc.challengeCollection.FindOne(ctx, filter).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+
+	solved, err := fc.submissionCollection.CountDocuments(ctx, bson.M{
+		"user":      userID,
+		"challenge": challengeID,
+		"isCorrect": true,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check submissions",
+		})
+	}
+	if solved == 0 {
+		attempts, err := fc.submissionCollection.CountDocuments(ctx, bson.M{
+			"user":      userID,
+			"challenge": challengeID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check submissions",
+			})
+		}
+		if minAttempts := feedbackMinAttempts(); attempts < int64(minAttempts) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Solve the challenge or make " + strconv.Itoa(minAttempts) + " attempts before rating it",
+			})
+		}
+	}
+
+	now := time.Now()
+	_, err = fc.collection.UpdateOne(
+		ctx,
+		bson.M{"challenge": challengeID, "user": userID},
+		bson.M{
+			"$set": bson.M{
+				"difficulty": feedback.Difficulty,
+				"quality":    feedback.Quality,
+				"comment":    feedback.Comment,
+				"solved":     solved > 0,
+				"updatedAt":  now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save feedback",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Feedback saved",
+	})
+}
+
+// GetChallengeFeedback returns the aggregated ratings and the comments of a
+// challenge. Only admins and the challenge author can read it.
+func (fc *FeedbackController) GetChallengeFeedback(c *fiber.Ctx) error {
+	challengeID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var challenge models.Challenge
+	err = fc.challengeCollection.FindOne(ctx, bson.M{"_id": challengeID}).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Challenge not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch challenge",
+		})
+	}
+	if !canManageChallenge(c, &challenge) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only admins and the challenge author can read feedback",
+		})
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"challenge": challengeID}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":               nil,
+			"count":             bson.M{"$sum": 1},
+			"averageDifficulty": bson.M{"$avg": "$difficulty"},
+			"averageQuality":    bson.M{"$avg": "$quality"},
+			"solverCount":       bson.M{"$sum": bson.M{"$cond": bson.A{"$solved", 1, 0}}},
+		}}},
+	}
+
+	cursor, err := fc.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to aggregate feedback",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	var summaries []models.FeedbackSummary
+	if err = cursor.All(ctx, &summaries); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode feedback",
+		})
+	}
+	summary := models.FeedbackSummary{}
+	if len(summaries) > 0 {
+		summary = summaries[0]
+	}
+	summary.SuggestedDifficulty = models.SuggestDifficulty(summary.AverageDifficulty)
+
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+	commentCursor, err := fc.collection.Find(ctx, bson.M{"challenge": challengeID, "comment": bson.M{"$nin": bson.A{"", nil}}}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch feedback",
+		})
+	}
+	defer commentCursor.Close(ctx)
+
+	feedback := []models.Feedback{}
+	if err = commentCursor.All(ctx, &feedback); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode feedback",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"summary":           summary,
+		"currentDifficulty": challenge.Difficulty,
+		"feedback":          feedback,
+	})
+}
+
+func feedbackMinAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("FEEDBACK_MIN_ATTEMPTS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultFeedbackMinAttempts
+}
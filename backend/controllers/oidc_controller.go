@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"ctf-backend/auth"
+	"ctf-backend/config"
+	"ctf-backend/models"
+	"ctf-backend/oidc"
+)
+
+// oidcLoginTTL is how long a user has to come back from the issuer
+const oidcLoginTTL = 10 * time.Minute
+
+var errOIDCNotConfigured = errors.New("OIDC login is not configured")
+
+// OIDCController signs users in with an OpenID Connect issuer. Start hands
+// the client an authorization URL; the issuer redirects back to the
+// frontend, which posts the code and state to Callback.
+//
+// Identities are matched by issuer and subject first. Otherwise a verified
+// email links the identity to the existing account with that email, and
+// unknown users get a new account when auto provisioning is on. Linking an
+// account whose own email was never verified clears its password and 2FA
+// and ends its sessions and API tokens.
+type OIDCController struct {
+	collection        *mongo.Collection
+	loginCollection   *mongo.Collection
+	sessionCollection *mongo.Collection
+	revokedCollection *mongo.Collection
+	tokenCollection   *mongo.Collection
+	resetCollection   *mongo.Collection
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCController(db *mongo.Database) *OIDCController {
+	return &OIDCController{
+		collection:        db.Collection("users"),
+		loginCollection:   db.Collection("oidc_logins"),
+		sessionCollection: db.Collection("sessions"),
+		revokedCollection: db.Collection("revoked_tokens"),
+		tokenCollection:   db.Collection("api_tokens"),
+		resetCollection:   db.Collection("password_resets"),
+	}
+}
+
+// Start begins a login and returns the issuer URL to send the user to
+func (oc *OIDCController) Start(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := oc.getProvider(ctx)
+	if err != nil {
+		return oidcUnavailable(c, err)
+	}
+
+	state, errState := oidc.NewState()
+	nonce, errNonce := oidc.NewState()
+	verifier, errVerifier := oidc.NewVerifier()
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+
+	login := models.OIDCLogin{State: state, Nonce: nonce, Verifier: verifier}
+	login.BeforeCreate(oidcLoginTTL)
+	if _, err := oc.loginCollection.InsertOne(ctx, login); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"authorizationUrl": provider.AuthURL(state, nonce, verifier),
+		"state":            state,
+	})
+}
+
+// Callback redeems the code the issuer returned and logs the user in
+func (oc *OIDCController) Callback(c *fiber.Ctx) error {
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Code == "" || input.State == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "code and state are required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	provider, err := oc.getProvider(ctx)
+	if err != nil {
+		return oidcUnavailable(c, err)
+	}
+
+	// Each state works once
+	var login models.OIDCLogin
+	err = oc.loginCollection.FindOneAndDelete(ctx, bson.M{
+		"_id":       input.State,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&login)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Login has expired, please start again",
+		})
+	}
+
+	identity, err := provider.Exchange(ctx, input.Code, login.Verifier, login.Nonce)
+	if err != nil {
+		log.Printf("OIDC exchange failed: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Could not verify the login with the identity provider",
+		})
+	}
+
+	user, status, msg := oc.resolveUser(ctx, identity)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if user.Ban.Active() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":  "Account is banned",
+			"reason": user.Ban.Reason,
+			"until":  user.Ban.Until,
+		})
+	}
+
+	return completeLogin(c, ctx, oc.sessionCollection, user)
+}
+
+// resolveUser finds, links or creates the user for an identity. On failure
+// it returns the status and message to answer with.
+func (oc *OIDCController) resolveUser(ctx context.Context, identity *oidc.Identity) (*models.User, int, string) {
+	var user models.User
+	err := oc.collection.FindOne(ctx, bson.M{
+		"oidc.issuer":  identity.Issuer,
+		"oidc.subject": identity.Subject,
+	}).Decode(&user)
+	if err == nil {
+		return &user, 0, ""
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fiber.StatusInternalServerError, "Failed to fetch user"
+	}
+
+	if identity.Email == "" {
+		return nil, fiber.StatusBadRequest, "The identity provider did not share an email address"
+	}
+
+	link := models.OIDCLink{Issuer: identity.Issuer, Subject: identity.Subject, LinkedAt: time.Now()}
+
+	err = oc.collection.FindOne(ctx, bson.M{"email": identity.Email}).Decode(&user)
+	if err == nil {
+		// Only an address the issuer vouches for may take over an account
+		if !identity.EmailVerified {
+			return nil, fiber.StatusConflict, "An account with this email already exists, log in with your password"
+		}
+		// An account whose address was never verified may have been
+		// registered by someone else ahead of its owner. Linking hands it to
+		// the owner, so whatever that person set up to get back in goes.
+		update := bson.M{"$set": bson.M{"oidc": link, "emailVerified": true}}
+		if !user.EmailVerified {
+			update["$unset"] = bson.M{"password": "", "twoFactor": ""}
+		}
+		result, err := oc.collection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "oidc": bson.M{"$exists": false}, "emailVerified": user.EmailVerified},
+			update,
+		)
+		if err != nil {
+			return nil, fiber.StatusInternalServerError, "Could not link account"
+		}
+		if result.MatchedCount == 0 {
+			return nil, fiber.StatusConflict, "This account is linked to another identity"
+		}
+		if !user.EmailVerified {
+			auth.Forget(user.ID)
+			if _, err := revokeSessions(ctx, oc.sessionCollection, oc.revokedCollection, bson.M{"user": user.ID}); err != nil {
+				return nil, fiber.StatusInternalServerError, "Could not link account"
+			}
+			if _, err := oc.tokenCollection.UpdateMany(ctx,
+				bson.M{"user": user.ID, "revokedAt": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+			); err != nil {
+				return nil, fiber.StatusInternalServerError, "Could not link account"
+			}
+			if _, err := oc.resetCollection.DeleteMany(ctx, bson.M{"user": user.ID}); err != nil {
+				return nil, fiber.StatusInternalServerError, "Could not link account"
+			}
+			user.Password = ""
+			user.TwoFactor = nil
+		}
+		user.OIDC = &link
+		user.EmailVerified = true
+		return &user, 0, ""
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fiber.StatusInternalServerError, "Failed to fetch user"
+	}
+
+	if !config.OIDCAutoProvision() {
+		return nil, fiber.StatusForbidden, "No account is linked to this identity"
+	}
+
+	// New accounts have no password; one can be set through a password reset
+	base := oidcUsername(identity)
+	user = models.User{
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Role:          models.RoleUser,
+		OIDC:          &link,
+	}
+	user.BeforeCreate()
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			suffix, err := randomToken(2)
+			if err != nil {
+				break
+			}
+			user.Username = fmt.Sprintf("%s-%s", base, suffix)
+		}
+
+		result, err := oc.collection.InsertOne(ctx, user)
+		if err == nil {
+			user.ID = result.InsertedID.(primitive.ObjectID)
+			return &user, 0, ""
+		}
+		if !mongo.IsDuplicateKeyError(err) || strings.Contains(err.Error(), "email") {
+			return nil, fiber.StatusInternalServerError, "Could not create account"
+		}
+	}
+	return nil, fiber.StatusConflict, "Could not find a free username"
+}
+
+// getProvider reads the issuer's discovery document on first use, and
+// again after a failure
+func (oc *OIDCController) getProvider(ctx context.Context) (*oidc.Provider, error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if oc.provider != nil {
+		return oc.provider, nil
+	}
+	cfg, ok := oidc.ConfigFromEnv()
+	if !ok {
+		return nil, errOIDCNotConfigured
+	}
+	provider, err := oidc.NewProvider(ctx, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	oc.provider = provider
+	return provider, nil
+}
+
+func oidcUnavailable(c *fiber.Ctx, err error) error {
+	if err == errOIDCNotConfigured {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("OIDC provider unavailable: %v", err)
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		"error": "Identity provider is unavailable",
+	})
+}
+
+// oidcUsername picks a username from the mapped claim, falling back to the
+// local part of the email
+func oidcUsername(identity *oidc.Identity) string {
+	name := identity.Username
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return -1
+	}, name)
+	if len(name) > 24 {
+		name = name[:24]
+	}
+	if len(name) < 3 {
+		name = "player"
+	}
+	return name
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor marks the last item of a page: the value of the sort key and
+// the _id used as tie-breaker. It is handed to clients as opaque base64.
+type pageCursor struct {
+	Value int64  `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(value int64, id primitive.ObjectID) string {
+	raw, _ := json.Marshal(pageCursor{Value: value, ID: id.Hex()})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (int64, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, primitive.NilObjectID, errors.New("invalid cursor")
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return 0, primitive.NilObjectID, errors.New("invalid cursor")
+	}
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return 0, primitive.NilObjectID, errors.New("invalid cursor")
+	}
+	return cursor.Value, id, nil
+}
+
+// cursorFilter selects the documents after (value, id) for a sort on field
+// followed by _id in the same direction.
+func cursorFilter(field string, value interface{}, id primitive.ObjectID, descending bool) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: value}},
+		bson.M{field: value, "_id": bson.M{op: id}},
+	}}
+}
+
+// pageLimit reads the limit query parameter, clamped to maxPageLimit.
+func pageLimit(c *fiber.Ctx) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
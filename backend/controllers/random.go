@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
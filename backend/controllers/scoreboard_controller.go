@@ -0,0 +1,588 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/config"
+	"ctf-backend/models"
+)
+
+const defaultAwardPlaces = 3
+
+type ScoreboardController struct {
+	submissionCollection *mongo.Collection
+	userCollection       *mongo.Collection
+	teamCollection       *mongo.Collection
+	writeupCollection    *mongo.Collection
+	bracketCollection    *mongo.Collection
+}
+
+func NewScoreboardController(db *mongo.Database) *ScoreboardController {
+	return &ScoreboardController{
+		submissionCollection: db.Collection("submissions"),
+		userCollection:       db.Collection("users"),
+		teamCollection:       db.Collection("teams"),
+		writeupCollection:    db.Collection("writeups"),
+		bracketCollection:    db.Collection("brackets"),
+	}
+}
+
+// GetScoreboard ranks users (mode=users, the default) or teams
+// (mode=teams). With bracket=<id> only verified members of that bracket are
+// listed and ranked among themselves.
+func (sc *ScoreboardController) GetScoreboard(c *fiber.Ctx) error {
+	mode := c.Query("mode", "users")
+	if mode != "users" && mode != "teams" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "mode must be users or teams",
+		})
+	}
+
+	var bracketID *primitive.ObjectID
+	if raw := c.Query("bracket"); raw != "" {
+		objID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid bracket ID",
+			})
+		}
+		bracketID = &objID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cutoff := scoreboardCutoff(c)
+	entries, err := sc.computeScoreboard(ctx, mode, cutoff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute scoreboard",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"mode":    mode,
+		"frozen":  cutoff != nil,
+		"entries": rankEntries(entries, bracketID),
+	})
+}
+
+// GetAwards returns the top AWARD_PLACES (default 3) of every bracket, plus
+// the overall podium.
+func (sc *ScoreboardController) GetAwards(c *fiber.Ctx) error {
+	mode := c.Query("mode", "teams")
+	if mode != "users" && mode != "teams" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "mode must be users or teams",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cutoff := scoreboardCutoff(c)
+	entries, err := sc.computeScoreboard(ctx, mode, cutoff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute scoreboard",
+		})
+	}
+
+	var brackets []models.Bracket
+	cursor, err := sc.bracketCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch brackets",
+		})
+	}
+	if err = cursor.All(ctx, &brackets); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode brackets",
+		})
+	}
+
+	places := awardPlaces()
+	podium := func(ranked []models.ScoreboardEntry) []models.ScoreboardEntry {
+		if len(ranked) > places {
+			return ranked[:places]
+		}
+		return ranked
+	}
+
+	awards := make([]fiber.Map, 0, len(brackets))
+	for _, bracket := range brackets {
+		bracketID := bracket.ID
+		awards = append(awards, fiber.Map{
+			"bracket": bracket,
+			"winners": podium(rankEntries(entries, &bracketID)),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"mode":     mode,
+		"frozen":   cutoff != nil,
+		"overall":  podium(rankEntries(entries, nil)),
+		"brackets": awards,
+	})
+}
+
+// computeScoreboard returns the scoreboard entries sorted by score, then by
+// earliest last solve.
+func (sc *ScoreboardController) computeScoreboard(ctx context.Context, mode string, cutoff *time.Time) ([]models.ScoreboardEntry, error) {
+	result, err := sc.scoreEntries(ctx, mode, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if outranks(result[i], result[j]) || outranks(result[j], result[i]) {
+			return outranks(result[i], result[j])
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// outranks reports whether a is placed above b: a higher score, or the same
+// score reached earlier. Entries with only bonus points come last.
+func outranks(a, b models.ScoreboardEntry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if a.LastSolve == nil || b.LastSolve == nil {
+		return a.LastSolve != nil && b.LastSolve == nil
+	}
+	return a.LastSolve.Before(*b.LastSolve)
+}
+
+// scoreEntries totals the correct submissions made up to cutoff (all of
+// them when nil) plus writeup bonus points, in no particular order. Team
+// solves count once per challenge. Hidden and banned users are left out,
+// and so are teams without any other member.
+func (sc *ScoreboardController) scoreEntries(ctx context.Context, mode string, cutoff *time.Time) ([]models.ScoreboardEntry, error) {
+	match := bson.M{"isCorrect": true}
+	if cutoff != nil {
+		match["createdAt"] = bson.M{"$lte": *cutoff}
+	}
+
+	key := "$user"
+	if mode == "teams" {
+		key = "$team"
+		match["team"] = bson.M{"$exists": true}
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		// First solve of each challenge per user or team
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"owner": key, "challenge": "$challenge"},
+			"points":   bson.M{"$first": "$pointsAwarded"},
+			"solvedAt": bson.M{"$first": "$createdAt"},
+		}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":       "$_id.owner",
+			"score":     bson.M{"$sum": "$points"},
+			"solves":    bson.M{"$sum": 1},
+			"lastSolve": bson.M{"$max": "$solvedAt"},
+		}}},
+	}
+
+	cursor, err := sc.submissionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var totals []struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		Score     int                `bson:"score"`
+		Solves    int                `bson:"solves"`
+		LastSolve time.Time          `bson:"lastSolve"`
+	}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+
+	entries := map[primitive.ObjectID]*models.ScoreboardEntry{}
+	for _, total := range totals {
+		lastSolve := total.LastSolve
+		entries[total.ID] = &models.ScoreboardEntry{
+			ID:        total.ID,
+			Score:     total.Score,
+			Solves:    total.Solves,
+			LastSolve: &lastSolve,
+		}
+	}
+
+	var users []models.User
+	cursor, err = sc.userCollection.Find(ctx,
+		bson.M{
+			"hidden": bson.M{"$ne": true},
+			"$or":    bson.A{bson.M{"ban": nil}, bson.M{"ban.until": bson.M{"$lte": time.Now()}}},
+		},
+		options.Find().SetProjection(bson.M{"username": 1, "bracket": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	listed := map[primitive.ObjectID]bool{}
+	for _, user := range users {
+		listed[user.ID] = true
+	}
+
+	bonuses, err := sc.writeupBonuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.ScoreboardEntry{}
+	if mode == "users" {
+		for _, user := range users {
+			entry, ok := entries[user.ID]
+			bonus := bonuses[user.ID]
+			if !ok && bonus == 0 {
+				continue
+			}
+			if !ok {
+				entry = &models.ScoreboardEntry{ID: user.ID}
+			}
+			entry.Name = user.Username
+			entry.Score += bonus
+			if user.Bracket != nil && user.Bracket.Verified {
+				bracketID := user.Bracket.BracketID
+				entry.BracketID = &bracketID
+			}
+			result = append(result, *entry)
+		}
+	} else {
+		var teams []models.Team
+		opts := options.Find().SetProjection(bson.M{"name": 1, "members": 1, "bracket": 1})
+		cursor, err = sc.teamCollection.Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err = cursor.All(ctx, &teams); err != nil {
+			return nil, err
+		}
+		for _, team := range teams {
+			bonus := 0
+			visible := false
+			for _, member := range team.Members {
+				bonus += bonuses[member]
+				visible = visible || listed[member]
+			}
+			entry, ok := entries[team.ID]
+			if !visible || (!ok && bonus == 0) {
+				continue
+			}
+			if !ok {
+				entry = &models.ScoreboardEntry{ID: team.ID}
+			}
+			entry.Name = team.Name
+			entry.Score += bonus
+			if team.Bracket != nil && team.Bracket.Verified {
+				bracketID := team.Bracket.BracketID
+				entry.BracketID = &bracketID
+			}
+			result = append(result, *entry)
+		}
+	}
+
+	return result, nil
+}
+
+// writeupBonuses sums the writeup bonus points of each user
+func (sc *ScoreboardController) writeupBonuses(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"status": models.WriteupApproved, "bonusPoints": bson.M{"$gt": 0}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$user", "bonus": bson.M{"$sum": "$bonusPoints"}}}},
+	}
+	cursor, err := sc.writeupCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Bonus int                `bson:"bonus"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	bonuses := map[primitive.ObjectID]int{}
+	for _, row := range rows {
+		bonuses[row.ID] = row.Bonus
+	}
+	return bonuses, nil
+}
+
+// rankEntries assigns ranks to sorted entries, restricted to one bracket
+// when bracketID is set. Ties on score and last solve share a rank.
+func rankEntries(entries []models.ScoreboardEntry, bracketID *primitive.ObjectID) []models.ScoreboardEntry {
+	ranked := []models.ScoreboardEntry{}
+	for _, entry := range entries {
+		if bracketID != nil && (entry.BracketID == nil || *entry.BracketID != *bracketID) {
+			continue
+		}
+		entry.Rank = len(ranked) + 1
+		if n := len(ranked); n > 0 {
+			prev := ranked[n-1]
+			if prev.Score == entry.Score && sameTime(prev.LastSolve, entry.LastSolve) {
+				entry.Rank = prev.Rank
+			}
+		}
+		ranked = append(ranked, entry)
+	}
+	return ranked
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// scoreboardCutoff returns the freeze time when the scoreboard is frozen
+// for the caller. Admins always see the live scoreboard.
+func scoreboardCutoff(c *fiber.Ctx) *time.Time {
+	if auth.FromContext(c).IsAdmin() {
+		return nil
+	}
+	if freeze, ok := config.ScoreboardFreeze(); ok && time.Now().After(freeze) {
+		return &freeze
+	}
+	return nil
+}
+
+func awardPlaces() int {
+	if n, err := strconv.Atoi(os.Getenv("AWARD_PLACES")); err == nil && n > 0 {
+		return n
+	}
+	return defaultAwardPlaces
+}
+
+// GetTeamProfile shows a team's members and their contributions, the
+// team's solves, points per category and rank, all computed from
+// submissions and subject to the scoreboard freeze.
+func (sc *ScoreboardController) GetTeamProfile(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var team models.Team
+	if err := sc.teamCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&team); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team not found",
+		})
+	}
+
+	cutoff := scoreboardCutoff(c)
+	profile, err := sc.buildProfile(ctx, "teams", team.ID, team.Name, cutoff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute team profile",
+		})
+	}
+
+	usernames, err := sc.usernames(ctx, team.Members)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch team members",
+		})
+	}
+
+	contributions := map[primitive.ObjectID]*models.MemberContribution{}
+	profile.Members = []models.MemberContribution{}
+	for _, member := range team.Members {
+		contributions[member] = &models.MemberContribution{ID: member, Username: usernames[member]}
+	}
+	for _, solve := range profile.Solves {
+		contribution, ok := contributions[solve.SolvedBy]
+		if !ok {
+			// Former members keep their share visible on the team
+			contribution = &models.MemberContribution{ID: solve.SolvedBy, Username: solve.Username}
+			contributions[solve.SolvedBy] = contribution
+		}
+		contribution.Solves++
+		contribution.Points += solve.Points
+	}
+	for _, member := range team.Members {
+		profile.Members = append(profile.Members, *contributions[member])
+	}
+
+	return c.JSON(profile)
+}
+
+// GetUserProfile shows a user's solves, points per category and rank
+func (sc *ScoreboardController) GetUserProfile(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"username": 1})
+	if err := sc.userCollection.FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	profile, err := sc.buildProfile(ctx, "users", user.ID, user.Username, scoreboardCutoff(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute user profile",
+		})
+	}
+
+	return c.JSON(profile)
+}
+
+// buildProfile collects the first solve of each challenge for a user or
+// team, and works out its rank on the overall scoreboard.
+func (sc *ScoreboardController) buildProfile(ctx context.Context, mode string, id primitive.ObjectID, name string, cutoff *time.Time) (*models.Profile, error) {
+	field := "user"
+	if mode == "teams" {
+		field = "team"
+	}
+	match := bson.M{field: id, "isCorrect": true}
+	if cutoff != nil {
+		match["createdAt"] = bson.M{"$lte": *cutoff}
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":      "$challenge",
+			"user":     bson.M{"$first": "$user"},
+			"points":   bson.M{"$first": "$pointsAwarded"},
+			"solvedAt": bson.M{"$first": "$createdAt"},
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "challenges",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "challenge",
+		}}},
+		bson.D{{Key: "$unwind", Value: "$challenge"}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         "users",
+			"localField":   "user",
+			"foreignField": "_id",
+			"as":           "solver",
+		}}},
+		bson.D{{Key: "$unwind", Value: bson.M{"path": "$solver", "preserveNullAndEmptyArrays": true}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"challengeId": "$_id",
+			"title":       "$challenge.title",
+			"category":    "$challenge.category",
+			"points":      1,
+			"solvedBy":    "$user",
+			"username":    "$solver.username",
+			"solvedAt":    1,
+		}}},
+		bson.D{{Key: "$sort", Value: bson.M{"solvedAt": 1}}},
+	}
+
+	cursor, err := sc.submissionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ChallengeID primitive.ObjectID `bson:"challengeId"`
+		Title       string             `bson:"title"`
+		Category    string             `bson:"category"`
+		Points      int                `bson:"points"`
+		SolvedBy    primitive.ObjectID `bson:"solvedBy"`
+		Username    string             `bson:"username"`
+		SolvedAt    time.Time          `bson:"solvedAt"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	profile := &models.Profile{
+		ID:               id,
+		Name:             name,
+		Frozen:           cutoff != nil,
+		Solves:           []models.ProfileSolve{},
+		PointsByCategory: map[string]int{},
+	}
+	for _, row := range rows {
+		profile.Solves = append(profile.Solves, models.ProfileSolve(row))
+		profile.PointsByCategory[row.Category] += row.Points
+		profile.Score += row.Points
+	}
+
+	entries, err := sc.scoreEntries(ctx, mode, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	var own *models.ScoreboardEntry
+	for i := range entries {
+		if entries[i].ID == id {
+			own = &entries[i]
+			break
+		}
+	}
+	if own == nil {
+		return profile, nil
+	}
+	// Ties share a rank, as on the scoreboard
+	profile.Score = own.Score
+	profile.Rank = 1
+	for _, entry := range entries {
+		if outranks(entry, *own) {
+			profile.Rank++
+		}
+	}
+
+	return profile, nil
+}
+
+// usernames maps user IDs to usernames
+func (sc *ScoreboardController) usernames(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	usernames := map[primitive.ObjectID]string{}
+	if len(ids) == 0 {
+		return usernames, nil
+	}
+
+	var users []models.User
+	opts := options.Find().SetProjection(bson.M{"username": 1})
+	cursor, err := sc.userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames, nil
+}
@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/config"
+	"ctf-backend/models"
+)
+
+// SessionController manages refresh tokens and logouts. Access tokens are
+// short lived JWTs; each login opens a session whose refresh token rotates
+// on every use. Presenting a refresh token that has already been rotated
+// away revokes the whole session, since it means the token was copied.
+type SessionController struct {
+	collection        *mongo.Collection
+	revokedCollection *mongo.Collection
+	userCollection    *mongo.Collection
+}
+
+func NewSessionController(db *mongo.Database) *SessionController {
+	return &SessionController{
+		collection:        db.Collection("sessions"),
+		revokedCollection: db.Collection("revoked_tokens"),
+		userCollection:    db.Collection("users"),
+	}
+}
+
+// authTokens is the token pair returned by login and refresh
+type authTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// Refresh swaps a refresh token for a new access and refresh token pair
+func (sc *SessionController) Refresh(c *fiber.Ctx) error {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "refreshToken is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hash := hashToken(input.RefreshToken)
+
+	var session models.Session
+	err := sc.collection.FindOne(ctx, bson.M{"tokenHash": hash}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		// A rotated token coming back means it leaked, end that session
+		var reused models.Session
+		err = sc.collection.FindOne(ctx, bson.M{"previousTokenHash": hash}).Decode(&reused)
+		if err == nil {
+			_, err = revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"_id": reused.ID})
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to revoke session",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch session",
+		})
+	}
+	if !session.Active() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has expired or was revoked",
+		})
+	}
+
+	var user models.User
+	if err := sc.userCollection.FindOne(ctx, bson.M{"_id": session.UserID}).Decode(&user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch user",
+			})
+		}
+		if _, err := revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"_id": session.ID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to revoke session",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.Ban.Active() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is banned",
+		})
+	}
+
+	access, jti, accessExp, err := signAccessToken(&user, session.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate token",
+		})
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate token",
+		})
+	}
+
+	// Conditional on the old hash so two concurrent refreshes cannot both win
+	result, err := sc.collection.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "tokenHash": hash, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{
+			"tokenHash":         hashToken(refresh),
+			"previousTokenHash": hash,
+			"accessTokenId":     jti,
+			"accessExpiresAt":   accessExp,
+			"lastUsedAt":        time.Now(),
+			"userAgent":         c.Get(fiber.HeaderUserAgent),
+			"ip":                c.IP(),
+		}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh session",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	}
+
+	// The access token this one replaces stops working now
+	if session.AccessExpiresAt.After(time.Now()) {
+		if err := denyToken(ctx, sc.revokedCollection, session.AccessTokenID, session.AccessExpiresAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to refresh session",
+			})
+		}
+	}
+
+	return c.JSON(authTokens{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(config.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout ends the session of the current access token
+func (sc *SessionController) Logout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	caller := auth.FromContext(c)
+
+	if sessionID, err := primitive.ObjectIDFromHex(caller.SessionID); err == nil {
+		if _, err := revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"_id": sessionID}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to log out",
+			})
+		}
+	}
+	if err := denyToken(ctx, sc.revokedCollection, caller.TokenID, time.Now().Add(config.AccessTokenTTL())); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out",
+	})
+}
+
+// LogoutAll ends every session of the current user, on all devices
+func (sc *SessionController) LogoutAll(c *fiber.Ctx) error {
+	userID := auth.FromContext(c).ID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"user": userID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+	if err := denyToken(ctx, sc.revokedCollection, auth.FromContext(c).TokenID, time.Now().Add(config.AccessTokenTTL())); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out of all devices",
+		"revoked": count,
+	})
+}
+
+// GetMySessions lists the current user's active sessions
+func (sc *SessionController) GetMySessions(c *fiber.Ctx) error {
+	userID := auth.FromContext(c).ID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"lastUsedAt": -1})
+	cursor, err := sc.collection.Find(ctx, bson.M{
+		"user":      userID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode sessions",
+		})
+	}
+
+	current := auth.FromContext(c).SessionID
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, fiber.Map{
+			"session": session,
+			"current": session.ID.Hex() == current,
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// RevokeMySession ends one of the current user's sessions
+func (sc *SessionController) RevokeMySession(c *fiber.Ctx) error {
+	userID := auth.FromContext(c).ID()
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("sessionId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"_id": sessionID, "user": userID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke session",
+		})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeUserSessions lets an admin end every session of a user
+func (sc *SessionController) RevokeUserSessions(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := revokeSessions(ctx, sc.collection, sc.revokedCollection, bson.M{"user": userID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Sessions revoked",
+		"revoked": count,
+	})
+}
+
+// openSession starts a session for a user who just logged in
+func openSession(ctx context.Context, sessions *mongo.Collection, user *models.User, c *fiber.Ctx) (*authTokens, error) {
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hashToken(refresh),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
+	}
+	session.BeforeCreate(config.RefreshTokenTTL())
+
+	access, jti, accessExp, err := signAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.AccessTokenID = jti
+	session.AccessExpiresAt = accessExp
+
+	if _, err := sessions.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &authTokens{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(config.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// signAccessToken issues a short lived access token bound to a session
+func signAccessToken(user *models.User, sessionID primitive.ObjectID) (string, string, time.Time, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	now := time.Now()
+	exp := now.Add(config.AccessTokenTTL())
+
+	signed, err := auth.Sign(jwt.MapClaims{
+		"userID":  user.ID.Hex(),
+		"isAdmin": user.Role == models.RoleAdmin,
+		"role":    user.Role,
+		"sid":     sessionID.Hex(),
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     exp.Unix(),
+	})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return signed, jti, exp, nil
+}
+
+// revokeSessions revokes the active sessions matching filter and denylists
+// their latest access tokens. Older tokens of the sessions are rejected by
+// the auth middleware once it sees the session ended. It returns how many
+// were revoked.
+func revokeSessions(ctx context.Context, sessions, revoked *mongo.Collection, filter bson.M) (int64, error) {
+	filter["revokedAt"] = bson.M{"$exists": false}
+
+	cursor, err := sessions.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var active []models.Session
+	if err = cursor.All(ctx, &active); err != nil {
+		return 0, err
+	}
+
+	for _, session := range active {
+		if session.AccessExpiresAt.After(time.Now()) {
+			if err := denyToken(ctx, revoked, session.AccessTokenID, session.AccessExpiresAt); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	result, err := sessions.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	for _, session := range active {
+		auth.ForgetSession(session.ID)
+	}
+	return result.ModifiedCount, nil
+}
+
+// denyToken adds an access token ID to the denylist until it expires
+func denyToken(ctx context.Context, revoked *mongo.Collection, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	_, err := revoked.UpdateOne(ctx,
+		bson.M{"_id": jti},
+		bson.M{"$setOnInsert": models.RevokedToken{ID: jti, ExpiresAt: expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// hashToken hashes an opaque token for storage
+func hashToken(token string) string {
+	return auth.HashToken(token)
+}
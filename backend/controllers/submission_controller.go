@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,24 +10,36 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"ctf-backend/auth"
+	"ctf-backend/config"
 	"ctf-backend/models"
 )
 
 type SubmissionController struct {
 	submissionCollection *mongo.Collection
 	challengeCollection  *mongo.Collection
+	teamCollection       *mongo.Collection
+	userCollection       *mongo.Collection
 }
 
 func NewSubmissionController(db *mongo.Database) *SubmissionController {
 	return &SubmissionController{
 		submissionCollection: db.Collection("submissions"),
 		challengeCollection:  db.Collection("challenges"),
+		teamCollection:       db.Collection("teams"),
+		userCollection:       db.Collection("users"),
 	}
 }
 
 func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	userObjID, _ := primitive.ObjectIDFromHex(userID)
+	caller := auth.FromContext(c)
+	userObjID := caller.ID()
+
+	if config.EmailVerificationRequired() && !caller.Verified {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Verify your email address before submitting flags",
+		})
+	}
 
 	var submission struct {
 		ChallengeID string `json:"challengeId"`
@@ -51,10 +64,9 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err = sc.challengeCollection.FindOne(ctx, bson.M{
-		"_id":      challengeID,
-		"isActive": true,
-	}).Decode(&challenge)
+	filter := models.PublishedFilter()
+	filter["_id"] = challengeID
+	err = sc.challengeCollection.FindOne(ctx, filter).Decode(&challenge)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -70,9 +82,9 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	// Check if already solved
 	var existingSubmission models.Submission
 	err = sc.submissionCollection.FindOne(ctx, bson.M{
-		"userID":      userObjID,
-		"challengeID": challengeID,
-		"isCorrect":   true,
+		"user":      userObjID,
+		"challenge": challengeID,
+		"isCorrect": true,
 	}).Decode(&existingSubmission)
 
 	if err == nil {
@@ -86,6 +98,18 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	// Check if flag is correct
 	isCorrect := submission.Flag == challenge.Flag
 
+	// Solves are credited to the team the user is in at the time
+	var team models.Team
+	hasTeam := true
+	err = sc.teamCollection.FindOne(ctx, bson.M{"members": userObjID}).Decode(&team)
+	if err == mongo.ErrNoDocuments {
+		hasTeam = false
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify flag",
+		})
+	}
+
 	// Save submission
 	submissionDoc := models.Submission{
 		ID:            primitive.NewObjectID(),
@@ -99,10 +123,22 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	if isCorrect {
 		submissionDoc.PointsAwarded = challenge.Points
 	}
+	if hasTeam {
+		submissionDoc.TeamID = &team.ID
+	}
 
 	submissionDoc.BeforeCreate() // Set CreatedAt
 
+	// A unique index allows one correct submission per user and challenge,
+	// so of two concurrent correct submissions only one is stored
 	_, err = sc.submissionCollection.InsertOne(ctx, submissionDoc)
+	if isCorrect && mongo.IsDuplicateKeyError(err) {
+		return c.JSON(fiber.Map{
+			"correct": true,
+			"message": "You've already solved this challenge!",
+			"points":  challenge.Points,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to save submission",
@@ -110,6 +146,33 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	}
 
 	if isCorrect {
+		_, err = sc.challengeCollection.UpdateOne(ctx,
+			bson.M{"_id": challengeID},
+			bson.M{"$inc": bson.M{"solves": 1}},
+		)
+		if err != nil {
+			log.Printf("Failed to count solve for challenge %s: %v", challengeID.Hex(), err)
+		}
+
+		_, err = sc.userCollection.UpdateOne(ctx,
+			bson.M{"_id": userObjID},
+			bson.M{
+				"$inc": bson.M{"score": challenge.Points},
+				"$push": bson.M{"solvedChallenges": models.SolvedChallenge{
+					ChallengeID: challengeID,
+					SolvedAt:    submissionDoc.CreatedAt,
+					Points:      challenge.Points,
+				}},
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to update score for user %s: %v", userObjID.Hex(), err)
+		}
+
+		if hasTeam {
+			sc.creditTeam(ctx, team.ID, challengeID, submissionDoc.ID, challenge.Points)
+		}
+
 		return c.JSON(fiber.Map{
 			"correct": true,
 			"message": "Correct flag! Well done!",
@@ -123,9 +186,34 @@ func (sc *SubmissionController) SubmitFlag(c *fiber.Ctx) error {
 	})
 }
 
+// creditTeam adds the points of a solve to the team score, unless another
+// member already solved the challenge for the same team. The crediting
+// submission is marked, and a unique index allows one mark per team and
+// challenge, so concurrent solves cannot both credit the team.
+func (sc *SubmissionController) creditTeam(ctx context.Context, teamID, challengeID, submissionID primitive.ObjectID, points int) {
+	_, err := sc.submissionCollection.UpdateOne(ctx,
+		bson.M{"_id": submissionID},
+		bson.M{"$set": bson.M{"teamCredit": true}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to credit solve to team %s: %v", teamID.Hex(), err)
+		return
+	}
+
+	_, err = sc.teamCollection.UpdateOne(ctx,
+		bson.M{"_id": teamID},
+		bson.M{"$inc": bson.M{"score": points}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Failed to update score for team %s: %v", teamID.Hex(), err)
+	}
+}
+
 func (sc *SubmissionController) GetUserSubmissions(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	userObjID, _ := primitive.ObjectIDFromHex(userID)
+	userObjID := auth.FromContext(c).ID()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
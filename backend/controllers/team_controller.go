@@ -2,60 +2,129 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"ctf-backend/auth"
+	"ctf-backend/config"
 	"ctf-backend/models"
 )
 
+// inviteCodeBytes is the entropy of a team invite code
+const inviteCodeBytes = 12
+
+// Team membership rules:
+//   - Solves are credited to the team the solver was in at the time. A member
+//     who leaves or is kicked keeps their own solves and the team keeps the
+//     points it earned from them.
+//   - A captain who leaves hands over to the longest-standing member.
+//   - When the last member leaves or the captain disbands the team, it is
+//     deleted. Members keep their individual solves.
 type TeamController struct {
-	collection     *mongo.Collection
-	userCollection *mongo.Collection
+	collection        *mongo.Collection
+	userCollection    *mongo.Collection
+	requestCollection *mongo.Collection
+	bracketCollection *mongo.Collection
 }
 
 func NewTeamController(db *mongo.Database) *TeamController {
 	return &TeamController{
-		collection:     db.Collection("teams"),
-		userCollection: db.Collection("users"),
+		collection:        db.Collection("teams"),
+		userCollection:    db.Collection("users"),
+		requestCollection: db.Collection("team_requests"),
+		bracketCollection: db.Collection("brackets"),
 	}
 }
 
 func (tc *TeamController) CreateTeam(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	userObjID, _ := primitive.ObjectIDFromHex(userID)
+	userObjID := auth.FromContext(c).ID()
 
-	var team models.Team
-	if err := c.BodyParser(&team); err != nil {
+	var input struct {
+		Name      string `json:"name"`
+		BracketID string `json:"bracketId"`
+	}
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
-	// Check if user is already in a team
-	// (Simplification: assuming user model has team_id or we check team members)
-	// For now, let's just create the team
+	input.Name = strings.TrimSpace(input.Name)
+	if len(input.Name) < 3 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team name must be at least 3 characters",
+		})
+	}
 
-	team.CaptainID = userObjID
-	team.Members = []primitive.ObjectID{userObjID}
+	team := models.Team{
+		ID:        primitive.NewObjectID(),
+		Name:      input.Name,
+		CaptainID: userObjID,
+		Members:   []primitive.ObjectID{userObjID},
+	}
 	team.BeforeCreate()
 
+	token, err := randomToken(inviteCodeBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate invite code",
+		})
+	}
+	team.Token = token
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	team.Bracket, err = resolveBracket(ctx, tc.bracketCollection, input.BracketID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Check if user is already in a team
+	claimed, err := tc.claimTeam(ctx, userObjID, team.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create team",
+		})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You are already in a team",
+		})
+	}
+
 	result, err := tc.collection.InsertOne(ctx, team)
 	if err != nil {
+		tc.releaseTeam(ctx, team.ID, userObjID)
+		if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: members_1") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "You are already in a team",
+			})
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Team name is already taken",
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create team. Name might be taken.",
+			"error": "Failed to create team",
 		})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Team created successfully",
-		"teamId":  result.InsertedID,
+		"message":    "Team created successfully",
+		"teamId":     result.InsertedID,
+		"inviteCode": team.Token,
 	})
 }
 
@@ -78,7 +147,19 @@ func (tc *TeamController) GetAllTeams(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(teams)
+	usernames, err := tc.memberUsernames(ctx, teams...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch team members",
+		})
+	}
+
+	views := make([]models.PublicTeam, 0, len(teams))
+	for i := range teams {
+		views = append(views, teams[i].Public(usernames))
+	}
+
+	return c.JSON(views)
 }
 
 func (tc *TeamController) GetTeamByID(c *fiber.Ctx) error {
@@ -101,25 +182,743 @@ func (tc *TeamController) GetTeamByID(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(team)
+	usernames, err := tc.memberUsernames(ctx, team)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch team members",
+		})
+	}
+
+	// Members see the invite code, the captain and admins see everything
+	caller := auth.FromContext(c)
+	userObjID := caller.ID()
+	isAdmin := caller.IsAdmin()
+
+	view := team.Public(usernames)
+	if !isAdmin && (userObjID.IsZero() || !team.HasMember(userObjID)) {
+		return c.JSON(view)
+	}
+
+	memberView := models.MemberTeam{
+		PublicTeam: view,
+		CaptainID:  team.CaptainID,
+		InviteCode: team.Token,
+	}
+	if !isAdmin && team.CaptainID != userObjID {
+		return c.JSON(memberView)
+	}
+
+	return c.JSON(models.CaptainTeam{
+		MemberTeam: memberView,
+		MaxSize:    config.MaxTeamSize(),
+		UpdatedAt:  team.UpdatedAt,
+	})
+}
+
+// memberUsernames maps the member IDs of the given teams to usernames
+func (tc *TeamController) memberUsernames(ctx context.Context, teams ...models.Team) (map[primitive.ObjectID]string, error) {
+	var ids []primitive.ObjectID
+	for _, team := range teams {
+		ids = append(ids, team.Members...)
+	}
+	usernames := map[primitive.ObjectID]string{}
+	if len(ids) == 0 {
+		return usernames, nil
+	}
+
+	cursor, err := tc.userCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"username": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames, nil
 }
 
+// UpdateTeam lets the captain rename the team and hand captaincy to another
+// member.
 func (tc *TeamController) UpdateTeam(c *fiber.Ctx) error {
-	// TODO: Implement update logic (e.g. rename)
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		CaptainID *string `json:"captainId"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	filter := bson.M{"_id": teamID, "captain": userObjID}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if len(name) < 3 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Team name must be at least 3 characters",
+			})
+		}
+		set["name"] = name
+	}
+	if input.CaptainID != nil {
+		captainID, err := primitive.ObjectIDFromHex(*input.CaptainID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid captain ID",
+			})
+		}
+		// The new captain has to be a member at the time of the update
+		filter["members"] = captainID
+		set["captain"] = captainID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := tc.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Team name is already taken",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update team",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the captain can update the team, and the new captain must be a member",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Team updated successfully",
+	})
 }
 
+// DeleteTeam disbands a team. Only its captain or an admin can do this.
 func (tc *TeamController) DeleteTeam(c *fiber.Ctx) error {
-	// TODO: Implement delete logic
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userObjID := auth.FromContext(c).ID()
+	isAdmin := auth.FromContext(c).IsAdmin()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	filter := bson.M{"_id": teamID}
+	if !isAdmin {
+		filter["captain"] = userObjID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := tc.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disband team",
+		})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the team captain can disband the team",
+		})
+	}
+	tc.releaseTeam(ctx, teamID)
+
+	return c.JSON(fiber.Map{
+		"message": "Team disbanded",
+	})
 }
 
+// JoinTeam adds the caller to a team using its invite code. The code check,
+// the size limit and the membership change happen in a single update.
 func (tc *TeamController) JoinTeam(c *fiber.Ctx) error {
-	// TODO: Implement join logic
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invite code is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if status, message := tc.addMember(ctx, teamID, userObjID, bson.M{"token": input.Token}); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Joined team successfully",
+	})
 }
 
+// RotateInviteCode replaces the team's invite code. Only the captain can do
+// this; the old code stops working immediately.
+func (tc *TeamController) RotateInviteCode(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	token, err := randomToken(inviteCodeBytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate invite code",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := tc.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": teamID, "captain": userObjID},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rotate invite code",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the team captain can rotate the invite code",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"inviteCode": token,
+	})
+}
+
+// LeaveTeam removes the caller from a team. A leaving captain hands over
+// to the longest-standing member; the last member leaving disbands the team.
 func (tc *TeamController) LeaveTeam(c *fiber.Ctx) error {
-	// TODO: Implement leave logic
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var team models.Team
+	err = tc.collection.FindOne(ctx, bson.M{"_id": teamID, "members": userObjID}).Decode(&team)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "You are not a member of this team",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to leave team",
+		})
+	}
+
+	remaining := make([]primitive.ObjectID, 0, len(team.Members))
+	for _, member := range team.Members {
+		if member != userObjID {
+			remaining = append(remaining, member)
+		}
+	}
+
+	if len(remaining) == 0 {
+		result, err := tc.collection.DeleteOne(ctx, bson.M{"_id": teamID, "members": bson.M{"$eq": team.Members}})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to leave team",
+			})
+		}
+		if result.DeletedCount == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Team changed while leaving, try again",
+			})
+		}
+		tc.releaseTeam(ctx, teamID)
+		return c.JSON(fiber.Map{
+			"message": "Left team, the team was disbanded",
+		})
+	}
+
+	// Members are stored in join order, so the first remaining member is the
+	// longest-standing one
+	filter := bson.M{"_id": teamID, "members": userObjID, "captain": team.CaptainID}
+	set := bson.M{"updatedAt": time.Now()}
+	newCaptain := team.CaptainID
+	if team.CaptainID == userObjID {
+		newCaptain = remaining[0]
+		set["captain"] = newCaptain
+		filter["members"] = bson.M{"$eq": team.Members}
+	}
+
+	result, err := tc.collection.UpdateOne(ctx, filter, bson.M{
+		"$pull": bson.M{"members": userObjID},
+		"$set":  set,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to leave team",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Team changed while leaving, try again",
+		})
+	}
+	tc.releaseTeam(ctx, teamID, userObjID)
+
+	return c.JSON(fiber.Map{
+		"message":   "Left team successfully",
+		"captainId": newCaptain,
+	})
+}
+
+// KickMember lets the captain remove another member from the team
+func (tc *TeamController) KickMember(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if memberID == userObjID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Captains leave the team instead of kicking themselves",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := tc.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": teamID, "captain": userObjID, "members": memberID},
+		bson.M{
+			"$pull": bson.M{"members": memberID},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove member",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the captain can remove members of this team",
+		})
+	}
+	tc.releaseTeam(ctx, teamID, memberID)
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed from team",
+	})
+}
+
+// RequestToJoin asks to join a team without an invite code. A player can
+// have one open request per team; it expires after TEAM_REQUEST_TTL.
+func (tc *TeamController) RequestToJoin(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	var input struct {
+		Message string `json:"message"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+	input.Message = strings.TrimSpace(input.Message)
+	if len([]rune(input.Message)) > 300 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Message must be at most 300 characters",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := tc.userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.TeamID != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You are already in a team",
+		})
+	}
+	if err := tc.collection.FindOne(ctx, bson.M{"_id": teamID}).Err(); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team not found",
+		})
+	}
+
+	// Old requests past their expiry no longer block a new one
+	_, err = tc.requestCollection.UpdateMany(ctx,
+		bson.M{"team": teamID, "user": userObjID, "status": models.TeamRequestPending, "expiresAt": bson.M{"$lte": time.Now()}},
+		bson.M{"$set": bson.M{"status": models.TeamRequestExpired}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create join request",
+		})
+	}
+
+	request := models.TeamRequest{
+		TeamID:   teamID,
+		UserID:   userObjID,
+		Username: user.Username,
+		Message:  input.Message,
+	}
+	request.BeforeCreate(config.TeamRequestTTL())
+
+	result, err := tc.requestCollection.InsertOne(ctx, request)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "You already have a pending request for this team",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create join request",
+		})
+	}
+	request.ID = result.InsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(request)
+}
+
+// GetJoinRequests lists the open join requests of a team (captain only)
+func (tc *TeamController) GetJoinRequests(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	isCaptain, err := tc.collection.CountDocuments(ctx, bson.M{"_id": teamID, "captain": userObjID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch join requests",
+		})
+	}
+	if isCaptain == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the team captain can see join requests",
+		})
+	}
+
+	return tc.listJoinRequests(c, ctx, bson.M{
+		"team":      teamID,
+		"status":    models.TeamRequestPending,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	})
+}
+
+// GetMyJoinRequests lists the caller's join requests with their decisions,
+// which is how players learn whether they were accepted.
+func (tc *TeamController) GetMyJoinRequests(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return tc.listJoinRequests(c, ctx, bson.M{"user": userObjID})
+}
+
+// AcceptJoinRequest adds the requesting player to the team. The team size
+// limit and one-team-per-user rule apply as for invite codes.
+func (tc *TeamController) AcceptJoinRequest(c *fiber.Ctx) error {
+	return tc.decideJoinRequest(c, models.TeamRequestAccepted)
+}
+
+// DeclineJoinRequest turns a join request down
+func (tc *TeamController) DeclineJoinRequest(c *fiber.Ctx) error {
+	return tc.decideJoinRequest(c, models.TeamRequestDeclined)
+}
+
+// CancelJoinRequest withdraws the caller's own pending request
+func (tc *TeamController) CancelJoinRequest(c *fiber.Ctx) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+	requestID, err := primitive.ObjectIDFromHex(c.Params("requestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := tc.requestCollection.UpdateOne(ctx,
+		bson.M{"_id": requestID, "team": teamID, "user": userObjID, "status": models.TeamRequestPending},
+		bson.M{"$set": bson.M{"status": models.TeamRequestCancelled, "decidedAt": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel join request",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Pending join request not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Join request cancelled",
+	})
+}
+
+func (tc *TeamController) decideJoinRequest(c *fiber.Ctx, decision string) error {
+	userObjID := auth.FromContext(c).ID()
+
+	teamID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+	requestID, err := primitive.ObjectIDFromHex(c.Params("requestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	isCaptain, err := tc.collection.CountDocuments(ctx, bson.M{"_id": teamID, "captain": userObjID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decide join request",
+		})
+	}
+	if isCaptain == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the team captain can decide join requests",
+		})
+	}
+
+	// Claim the request first so two decisions cannot both succeed
+	now := time.Now()
+	var request models.TeamRequest
+	err = tc.requestCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": requestID, "team": teamID, "status": models.TeamRequestPending, "expiresAt": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"status": decision, "decidedBy": userObjID, "decidedAt": now}},
+	).Decode(&request)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Pending join request not found or expired",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decide join request",
+		})
+	}
+
+	if decision == models.TeamRequestAccepted {
+		if status, message := tc.addMember(ctx, teamID, request.UserID, bson.M{}); status != 0 {
+			// Put the request back so the captain can retry or decline it
+			_, _ = tc.requestCollection.UpdateOne(ctx,
+				bson.M{"_id": requestID},
+				bson.M{"$set": bson.M{"status": models.TeamRequestPending}, "$unset": bson.M{"decidedBy": "", "decidedAt": ""}},
+			)
+			return c.Status(status).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+
+		// The player is in a team now, their other requests are moot
+		_, err = tc.requestCollection.UpdateMany(ctx,
+			bson.M{"user": request.UserID, "status": models.TeamRequestPending},
+			bson.M{"$set": bson.M{"status": models.TeamRequestCancelled, "decidedAt": now}},
+		)
+		if err != nil {
+			log.Printf("Failed to cancel other join requests of user %s: %v", request.UserID.Hex(), err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Join request " + decision,
+	})
+}
+
+func (tc *TeamController) listJoinRequests(c *fiber.Ctx, ctx context.Context, filter bson.M) error {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := tc.requestCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch join requests",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	requests := []models.TeamRequest{}
+	if err = cursor.All(ctx, &requests); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode join requests",
+		})
+	}
+	for i := range requests {
+		requests[i].Status = requests[i].EffectiveStatus()
+	}
+
+	return c.JSON(requests)
+}
+
+// addMember puts a user into a team. The user's team reference is claimed
+// first so they cannot join two teams at once; the team update then checks
+// extra (e.g. the invite code) and the size limit atomically. On failure it
+// returns an HTTP status and message, and the claim is released.
+func (tc *TeamController) addMember(ctx context.Context, teamID, userID primitive.ObjectID, extra bson.M) (int, string) {
+	claimed, err := tc.claimTeam(ctx, userID, teamID)
+	if err != nil {
+		return fiber.StatusInternalServerError, "Failed to join team"
+	}
+	if !claimed {
+		return fiber.StatusConflict, "You are already in a team"
+	}
+
+	filter := bson.M{"_id": teamID, "members": bson.M{"$ne": userID}}
+	for key, value := range extra {
+		filter[key] = value
+	}
+	maxSize := config.MaxTeamSize()
+	if maxSize > 0 {
+		filter[fmt.Sprintf("members.%d", maxSize-1)] = bson.M{"$exists": false}
+	}
+
+	result, err := tc.collection.UpdateOne(ctx, filter, bson.M{
+		"$push": bson.M{"members": userID},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		tc.releaseTeam(ctx, teamID, userID)
+	}
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fiber.StatusConflict, "You are already in a team"
+		}
+		return fiber.StatusInternalServerError, "Failed to join team"
+	}
+	if result.MatchedCount == 0 {
+		var team models.Team
+		extra["_id"] = teamID
+		if tc.collection.FindOne(ctx, extra).Decode(&team) == nil && maxSize > 0 && len(team.Members) >= maxSize {
+			return fiber.StatusConflict, fmt.Sprintf("Team is full (maximum %d members)", maxSize)
+		}
+		return fiber.StatusForbidden, "Invalid team or invite code"
+	}
+
+	return 0, ""
+}
+
+// claimTeam records teamID on the user unless they are already in a team
+func (tc *TeamController) claimTeam(ctx context.Context, userID, teamID primitive.ObjectID) (bool, error) {
+	result, err := tc.userCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "team": nil},
+		bson.M{"$set": bson.M{"team": teamID}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// releaseTeam clears the team reference of the given users, or of every
+// user still pointing at teamID when none are given.
+func (tc *TeamController) releaseTeam(ctx context.Context, teamID primitive.ObjectID, userIDs ...primitive.ObjectID) {
+	filter := bson.M{"team": teamID}
+	if len(userIDs) > 0 {
+		filter["_id"] = bson.M{"$in": userIDs}
+	}
+	if _, err := tc.userCollection.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"team": ""}}); err != nil {
+		log.Printf("Failed to clear team %s from users: %v", teamID.Hex(), err)
+	}
 }
@@ -0,0 +1,404 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+
+	"ctf-backend/auth"
+	"ctf-backend/config"
+	"ctf-backend/models"
+)
+
+// Recovery code and lockout settings
+const (
+	recoveryCodeCount    = 10
+	twoFactorMaxFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// TwoFactorController handles TOTP enrolment and the second step of login.
+// Enrolment is two steps: setup creates a pending secret, enable confirms it
+// with a first code and hands out recovery codes.
+type TwoFactorController struct {
+	collection        *mongo.Collection
+	sessionCollection *mongo.Collection
+}
+
+func NewTwoFactorController(db *mongo.Database) *TwoFactorController {
+	return &TwoFactorController{
+		collection:        db.Collection("users"),
+		sessionCollection: db.Collection("sessions"),
+	}
+}
+
+// Setup creates a pending TOTP secret and returns its otpauth URI
+func (tc *TwoFactorController) Setup(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := tc.currentUser(ctx, c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.TwoFactorEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate secret",
+		})
+	}
+
+	_, err = tc.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "twoFactor.enabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"twoFactor": models.TwoFactor{Secret: secret}}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start enrolment",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":     secret,
+		"otpauthUri": auth.TOTPURI(config.EventName(), user.Username, secret),
+	})
+}
+
+// Enable confirms the pending secret with a code and returns recovery codes.
+// The codes are shown only this once.
+func (tc *TwoFactorController) Enable(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := tc.currentUser(ctx, c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.TwoFactor == nil || user.TwoFactor.Enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "No pending two-factor enrolment, call setup first",
+		})
+	}
+
+	step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, strings.TrimSpace(input.Code), time.Now(), 0)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate recovery codes",
+		})
+	}
+
+	now := time.Now()
+	result, err := tc.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "twoFactor.secret": user.TwoFactor.Secret, "twoFactor.enabled": false},
+		bson.M{"$set": bson.M{
+			"twoFactor.enabled":       true,
+			"twoFactor.enabledAt":     now,
+			"twoFactor.lastStep":      step,
+			"twoFactor.recoveryCodes": hashes,
+		}},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Could not enable two-factor authentication",
+		})
+	}
+	auth.Forget(user.ID)
+
+	return c.JSON(fiber.Map{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable turns 2FA off. It needs the password and a code or recovery code,
+// and is refused for admins when the event requires 2FA for them.
+func (tc *TwoFactorController) Disable(c *fiber.Ctx) error {
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := tc.currentUser(ctx, c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if !user.TwoFactorEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+	if user.Role == models.RoleAdmin && config.AdminTwoFactorRequired() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Two-factor authentication is mandatory for admins",
+		})
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid credentials",
+		})
+	}
+	if status, msg := verifySecondFactor(ctx, tc.collection, user, input.Code, input.RecoveryCode); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if _, err := tc.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"twoFactor": ""}}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not disable two-factor authentication",
+		})
+	}
+	auth.Forget(user.ID)
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a
+// current TOTP code
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := tc.currentUser(ctx, c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if !user.TwoFactorEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+	if status, msg := verifySecondFactor(ctx, tc.collection, user, input.Code, ""); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate recovery codes",
+		})
+	}
+	if _, err := tc.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"twoFactor.recoveryCodes": hashes}}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not save recovery codes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recoveryCodes": codes,
+	})
+}
+
+// VerifyLogin is the second login step. It takes the challenge token from
+// the password step and a TOTP or recovery code, and opens a session.
+func (tc *TwoFactorController) VerifyLogin(c *fiber.Ctx) error {
+	var input struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.ChallengeToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "challengeToken is required",
+		})
+	}
+
+	claims, err := auth.ParsePurpose(input.ChallengeToken, auth.PurposeLoginChallenge)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Login challenge is invalid or has expired",
+		})
+	}
+	subject, _ := claims["sub"].(string)
+	userID, err := primitive.ObjectIDFromHex(subject)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Login challenge is invalid or has expired",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := tc.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || !user.TwoFactorEnabled() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Login challenge is invalid or has expired",
+		})
+	}
+	if user.Ban.Active() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":  "Account is banned",
+			"reason": user.Ban.Reason,
+			"until":  user.Ban.Until,
+		})
+	}
+	if status, msg := verifySecondFactor(ctx, tc.collection, &user, input.Code, input.RecoveryCode); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	return loginResponse(c, ctx, tc.sessionCollection, &user)
+}
+
+func (tc *TwoFactorController) currentUser(ctx context.Context, c *fiber.Ctx) (*models.User, error) {
+	var user models.User
+	if err := tc.collection.FindOne(ctx, bson.M{"_id": auth.FromContext(c).ID()}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// consuming it so it cannot be replayed. Repeated failures lock 2FA for a
+// while. It returns a status and message to answer with, or zero on success.
+func verifySecondFactor(ctx context.Context, users *mongo.Collection, user *models.User, code, recoveryCode string) (int, string) {
+	now := time.Now()
+	if until := user.TwoFactor.LockedUntil; until != nil && now.Before(*until) {
+		return fiber.StatusTooManyRequests, "Too many failed attempts, try again later"
+	}
+	// Checked again on the write, in case parallel attempts locked it since
+	unlocked := bson.A{
+		bson.M{"twoFactor.lockedUntil": nil},
+		bson.M{"twoFactor.lockedUntil": bson.M{"$lte": now}},
+	}
+
+	ok := false
+	if code = strings.TrimSpace(code); code != "" {
+		if step, valid := auth.ValidateTOTP(user.TwoFactor.Secret, code, now, user.TwoFactor.LastStep); valid {
+			// Conditional on the step so a code works once even under races
+			result, err := users.UpdateOne(ctx,
+				bson.M{"_id": user.ID, "twoFactor.lastStep": bson.M{"$lt": step}, "$or": unlocked},
+				bson.M{"$set": bson.M{"twoFactor.lastStep": step}},
+			)
+			ok = err == nil && result.ModifiedCount == 1
+		}
+	} else if recoveryCode != "" {
+		result, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "$or": unlocked},
+			bson.M{"$pull": bson.M{"twoFactor.recoveryCodes": hashRecoveryCode(recoveryCode)}},
+		)
+		ok = err == nil && result.ModifiedCount == 1
+	} else {
+		return fiber.StatusBadRequest, "code or recoveryCode is required"
+	}
+
+	if ok {
+		_, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{
+			"twoFactor.failedAttempts": "",
+			"twoFactor.lockedUntil":    "",
+		}})
+		if err != nil {
+			log.Printf("Failed to clear 2FA failures for user %s: %v", user.ID.Hex(), err)
+		}
+		return 0, ""
+	}
+
+	// The count comes back from the increment itself, so parallel guesses
+	// cannot all see the same stale count
+	var after models.User
+	err := users.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$inc": bson.M{"twoFactor.failedAttempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"twoFactor.failedAttempts": 1}),
+	).Decode(&after)
+	if err != nil {
+		return fiber.StatusInternalServerError, "Failed to verify code"
+	}
+	if after.TwoFactor != nil && after.TwoFactor.Failures >= twoFactorMaxFailures {
+		_, err = users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "twoFactor.failedAttempts": bson.M{"$gte": twoFactorMaxFailures}},
+			bson.M{
+				"$set":   bson.M{"twoFactor.lockedUntil": time.Now().Add(twoFactorLockout)},
+				"$unset": bson.M{"twoFactor.failedAttempts": ""},
+			},
+		)
+		if err != nil {
+			return fiber.StatusInternalServerError, "Failed to verify code"
+		}
+	}
+	return fiber.StatusUnauthorized, "Invalid code"
+}
+
+// newRecoveryCodes returns fresh recovery codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and dashes
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return hashToken(normalized)
+}
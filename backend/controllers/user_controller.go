@@ -2,7 +2,11 @@ package controllers
 
 import (
 	"context"
-	"os"
+	"encoding/json"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,55 +14,90 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 
+	"ctf-backend/auth"
+	"ctf-backend/config"
+	"ctf-backend/mailer"
 	"ctf-backend/models"
 )
 
 type UserController struct {
-	collection *mongo.Collection
+	collection        *mongo.Collection
+	bracketCollection *mongo.Collection
+	sessionCollection *mongo.Collection
+	revokedCollection *mongo.Collection
+	resetCollection   *mongo.Collection
+	mailer            mailer.Mailer
 }
 
 func NewUserController(db *mongo.Database) *UserController {
 	return &UserController{
-		collection: db.Collection("users"),
+		collection:        db.Collection("users"),
+		bracketCollection: db.Collection("brackets"),
+		sessionCollection: db.Collection("sessions"),
+		revokedCollection: db.Collection("revoked_tokens"),
+		resetCollection:   db.Collection("password_resets"),
+		mailer:            mailer.Default(),
 	}
 }
 
 // Register handles user registration
 func (uc *UserController) Register(c *fiber.Ctx) error {
-	var user models.User
+	var input struct {
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+		BracketID string `json:"bracketId"`
+	}
 
 	// Parse request body
-	if err := c.BodyParser(&user); err != nil {
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
 	// Validate required fields
-	if user.Username == "" || user.Password == "" || user.Email == "" {
+	if input.Username == "" || input.Password == "" || input.Email == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Username, password and email are required",
 		})
 	}
 
+	email, ok := parseEmail(input.Email)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email address",
+		})
+	}
+	input.Email = email
+
+	bracket, err := resolveBracket(context.Background(), uc.bracketCollection, input.BracketID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not hash password",
 		})
 	}
-	user.Password = string(hashedPassword)
 
-	// Set default role if not provided
-	if user.Role == "" {
-		user.Role = "user"
+	// Roles are granted by admins, never chosen at registration
+	user := models.User{
+		Username: input.Username,
+		Email:    input.Email,
+		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+		Bracket:  bracket,
 	}
-
-	user.CreatedAt = time.Now()
-	user.LastActive = time.Now()
+	user.BeforeCreate()
 
 	// Insert user into database
 	result, err := uc.collection.InsertOne(context.Background(), user)
@@ -67,6 +106,14 @@ func (uc *UserController) Register(c *fiber.Ctx) error {
 			"error": "Could not create user. Username or email might already be taken.",
 		})
 	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+
+	// A failed send is not fatal, the user can ask for another link
+	if config.EmailVerificationRequired() {
+		if err := uc.sendVerification(context.Background(), &user); err != nil {
+			log.Printf("Error sending verification email to %s: %v", user.ID.Hex(), err)
+		}
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "User registered successfully",
@@ -74,6 +121,270 @@ func (uc *UserController) Register(c *fiber.Ctx) error {
 	})
 }
 
+// VerifyEmail marks an address as verified using an emailed token. The
+// token is tied to the address it was sent to, so it stops working if the
+// email changes in the meantime.
+func (uc *UserController) VerifyEmail(c *fiber.Ctx) error {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token is required",
+		})
+	}
+
+	claims, err := auth.ParsePurpose(input.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	objID, err := primitive.ObjectIDFromHex(subject)
+	if err != nil || email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := uc.collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "email": email},
+		bson.M{"$set": bson.M{"emailVerified": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not verify email",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+	auth.Forget(objID)
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+// ResendVerification emails a new verification link to the current user
+func (uc *UserController) ResendVerification(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := uc.collection.FindOne(ctx, bson.M{"_id": auth.FromContext(c).ID()}).Decode(&user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if user.EmailVerified {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email is already verified",
+		})
+	}
+
+	if err := uc.sendVerification(ctx, &user); err != nil {
+		log.Printf("Error sending verification email to %s: %v", user.ID.Hex(), err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Could not send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// parseEmail checks a bare email address and returns it the way accounts
+// store it
+func parseEmail(raw string) (string, bool) {
+	address, err := mail.ParseAddress(raw)
+	if err != nil || address.Name != "" {
+		return "", false
+	}
+	return address.Address, true
+}
+
+// sendVerification emails a signed, expiring verification link
+func (uc *UserController) sendVerification(ctx context.Context, user *models.User) error {
+	ttl := config.EmailVerificationTTL()
+	token, err := auth.SignPurpose(auth.PurposeVerifyEmail, user.ID.Hex(), jwt.MapClaims{"email": user.Email}, ttl)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render("verify_email", user.Email, map[string]interface{}{
+		"Username":  user.Username,
+		"URL":       config.AppURL() + "/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": ttl.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return uc.mailer.Send(ctx, msg)
+}
+
+// ForgotPassword emails a password reset link. It answers the same way
+// whether or not the address belongs to an account, and sends the email in
+// the background so response times do not tell either. An account gets at
+// most one link per PASSWORD_RESET_COOLDOWN.
+func (uc *UserController) ForgotPassword(c *fiber.Ctx) error {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is required",
+		})
+	}
+	email, ok := parseEmail(input.Email)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email address",
+		})
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := uc.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+			return
+		}
+		recent, err := uc.resetCollection.CountDocuments(ctx, bson.M{
+			"user":      user.ID,
+			"createdAt": bson.M{"$gt": time.Now().Add(-config.PasswordResetCooldown())},
+		})
+		if err != nil {
+			log.Printf("Error checking password resets of %s: %v", user.ID.Hex(), err)
+			return
+		}
+		if recent > 0 {
+			return
+		}
+		if err := sendPasswordReset(ctx, uc.resetCollection, uc.mailer, &user); err != nil {
+			log.Printf("Error sending password reset to %s: %v", user.ID.Hex(), err)
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If an account uses this email, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using an emailed reset token, and ends
+// every session of the account.
+func (uc *UserController) ResetPassword(c *fiber.Ctx) error {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token and password are required",
+		})
+	}
+	if len(input.Password) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password must be at least 8 characters",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not hash password",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Claiming the token and marking it used is one step, so it works once
+	now := time.Now()
+	var reset models.PasswordReset
+	err = uc.resetCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(input.Token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&reset)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	result, err := uc.collection.UpdateOne(ctx,
+		bson.M{"_id": reset.UserID},
+		bson.M{"$set": bson.M{"password": string(hashedPassword)}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update password",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	// Other outstanding links for the account die with this one
+	if _, err := uc.resetCollection.DeleteMany(ctx, bson.M{"user": reset.UserID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		log.Printf("Error clearing password resets for %s: %v", reset.UserID.Hex(), err)
+	}
+	if _, err := revokeSessions(ctx, uc.sessionCollection, uc.revokedCollection, bson.M{"user": reset.UserID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Password changed, but sessions could not be revoked",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset, please log in again",
+	})
+}
+
+// sendPasswordReset stores the hash of a new single use reset token and
+// emails the token to the user. Earlier unused tokens are replaced.
+func sendPasswordReset(ctx context.Context, resets *mongo.Collection, m mailer.Mailer, user *models.User) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	if _, err := resets.DeleteMany(ctx, bson.M{"user": user.ID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		return err
+	}
+
+	ttl := config.PasswordResetTTL()
+	reset := models.PasswordReset{UserID: user.ID, TokenHash: hashToken(token)}
+	reset.BeforeCreate(ttl)
+	if _, err := resets.InsertOne(ctx, reset); err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render("reset_password", user.Email, map[string]interface{}{
+		"Username":  user.Username,
+		"URL":       config.AppURL() + "/reset-password?token=" + url.QueryEscape(token),
+		"ExpiresIn": ttl.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
 // Login handles user authentication
 func (uc *UserController) Login(c *fiber.Ctx) error {
 	var input struct {
@@ -102,14 +413,44 @@ func (uc *UserController) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":  user.ID.Hex(),
-		"isAdmin": user.Role == "admin",
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-	})
+	if user.Ban.Active() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":  "Account is banned",
+			"reason": user.Ban.Reason,
+			"until":  user.Ban.Until,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return completeLogin(c, ctx, uc.sessionCollection, &user)
+}
+
+// completeLogin finishes a first factor login. Users with 2FA get a short
+// lived challenge token for the second step instead of a session.
+func completeLogin(c *fiber.Ctx, ctx context.Context, sessions *mongo.Collection, user *models.User) error {
+	if user.TwoFactorEnabled() {
+		challenge, err := auth.SignPurpose(auth.PurposeLoginChallenge, user.ID.Hex(), nil, config.LoginChallengeTTL())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not generate token",
+			})
+		}
+		return c.JSON(fiber.Map{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"expiresIn":         int(config.LoginChallengeTTL().Seconds()),
+		})
+	}
+
+	return loginResponse(c, ctx, sessions, user)
+}
 
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+// loginResponse opens a session for an authenticated user and answers with
+// a short lived access token plus a refresh token for this device
+func loginResponse(c *fiber.Ctx, ctx context.Context, sessions *mongo.Collection, user *models.User) error {
+	tokens, err := openSession(ctx, sessions, user, c)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not generate token",
@@ -117,25 +458,27 @@ func (uc *UserController) Login(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"token": t,
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
 		"user": fiber.Map{
-			"id":       user.ID,
-			"username": user.Username,
-			"role":     user.Role,
+			"id":               user.ID,
+			"username":         user.Username,
+			"role":             user.Role,
+			"twoFactorEnabled": user.TwoFactorEnabled(),
 		},
 	})
 }
 
 // GetCurrentUser returns the currently logged in user
 func (uc *UserController) GetCurrentUser(c *fiber.Ctx) error {
-	userID := c.Locals("userID")
-	if userID == nil {
+	caller := auth.FromContext(c)
+	if caller == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Unauthorized",
 		})
 	}
-
-	objID, _ := primitive.ObjectIDFromHex(userID.(string))
+	objID := caller.UserID
 
 	var user models.User
 	err := uc.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
@@ -151,54 +494,302 @@ func (uc *UserController) GetCurrentUser(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
-// UpdateProfile updates the current user's profile
-func (uc *UserController) UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Locals("userID")
-	objID, _ := primitive.ObjectIDFromHex(userID.(string))
-
-	var updates map[string]interface{}
-	if err := c.BodyParser(&updates); err != nil {
+// GetUserByID returns the public view of a user. The user themselves and
+// admins get the full record.
+func (uc *UserController) GetUserByID(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON",
+			"error": "Invalid user ID",
 		})
 	}
 
-	delete(updates, "_id")
-	delete(updates, "role")   // User cannot update role
-	delete(updates, "points") // User cannot update points directly
-	delete(updates, "solves") // User cannot update solves directly
+	var user models.User
+	err = uc.collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
 
-	if password, ok := updates["password"].(string); ok && password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Could not hash password",
-			})
-		}
-		updates["password"] = string(hashedPassword)
+	caller := auth.FromContext(c)
+	if caller.IsAdmin() || caller.ID() == user.ID {
+		return c.JSON(user)
 	}
 
-	updates["lastActive"] = time.Now()
+	return c.JSON(user.Public())
+}
 
-	result, err := uc.collection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": objID},
-		bson.M{"$set": updates},
-	)
+// UpdateProfile updates the current user's public profile. Only the fields
+// in models.UserProfileFields can be changed here.
+func (uc *UserController) UpdateProfile(c *fiber.Ctx) error {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
 
+	var profile models.User
+	set, unset, err := profile.ApplyProfilePatch(patch)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	set["lastActive"] = time.Now()
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err = uc.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": auth.FromContext(c).ID()},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not update user",
 		})
 	}
 
+	return c.JSON(fiber.Map{
+		"message": "Profile updated successfully",
+		"user":    user,
+	})
+}
+
+// ChangeEmail moves the account to a new address after checking the
+// current password. The new address has to be verified again.
+func (uc *UserController) ChangeEmail(c *fiber.Ctx) error {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	email, ok := parseEmail(input.Email)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email address",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := uc.checkPassword(ctx, c, input.Password)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if email == user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This is already your email address",
+		})
+	}
+
+	result, err := uc.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "email": user.Email},
+		bson.M{"$set": bson.M{"email": email, "emailVerified": false}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email is already in use",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update email",
+		})
+	}
 	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email changed in the meantime, try again",
+		})
+	}
+	auth.Forget(user.ID)
+
+	// Reset links went to the old address
+	if _, err := uc.resetCollection.DeleteMany(ctx, bson.M{"user": user.ID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		log.Printf("Error clearing password resets for %s: %v", user.ID.Hex(), err)
+	}
+
+	user.Email = email
+	if err := uc.sendVerification(ctx, user); err != nil {
+		log.Printf("Error sending verification email to %s: %v", user.ID.Hex(), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email updated, check your inbox to verify it",
+		"email":   user.Email,
+	})
+}
+
+// ChangeUsername renames the current user, at most once per
+// config.UsernameChangeInterval
+func (uc *UserController) ChangeUsername(c *fiber.Ctx) error {
+	var input struct {
+		Username string `json:"username"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	input.Username = strings.TrimSpace(input.Username)
+	if len(input.Username) < 3 || len(input.Username) > 30 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Username must be between 3 and 30 characters",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := uc.collection.FindOne(ctx, bson.M{"_id": auth.FromContext(c).ID()}).Decode(&user); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
+	if input.Username == user.Username {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This is already your username",
+		})
+	}
+
+	now := time.Now()
+	interval := config.UsernameChangeInterval()
+	if user.UsernameChangedAt != nil && now.Before(user.UsernameChangedAt.Add(interval)) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   "Username was changed recently",
+			"retryAt": user.UsernameChangedAt.Add(interval),
+		})
+	}
+
+	// The filter repeats the check so concurrent renames cannot both pass
+	result, err := uc.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "$or": bson.A{
+			bson.M{"usernameChangedAt": bson.M{"$exists": false}},
+			bson.M{"usernameChangedAt": bson.M{"$lte": now.Add(-interval)}},
+		}},
+		bson.M{"$set": bson.M{"username": input.Username, "usernameChangedAt": now}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username is already taken",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update username",
+		})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Username was changed recently",
+		})
+	}
+	auth.Forget(user.ID)
 
 	return c.JSON(fiber.Map{
-		"message": "Profile updated successfully",
+		"message":  "Username updated",
+		"username": input.Username,
 	})
 }
+
+// ChangePassword sets a new password after checking the current one, and
+// logs out every other session
+func (uc *UserController) ChangePassword(c *fiber.Ctx) error {
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if len(input.NewPassword) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password must be at least 8 characters",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, status, msg := uc.checkPassword(ctx, c, input.CurrentPassword)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not hash password",
+		})
+	}
+	if _, err := uc.collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"password": string(hashedPassword)}},
+	); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update password",
+		})
+	}
+
+	if _, err := uc.resetCollection.DeleteMany(ctx, bson.M{"user": user.ID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		log.Printf("Error clearing password resets for %s: %v", user.ID.Hex(), err)
+	}
+	filter := bson.M{"user": user.ID}
+	if sessionID, err := primitive.ObjectIDFromHex(auth.FromContext(c).SessionID); err == nil {
+		filter["_id"] = bson.M{"$ne": sessionID}
+	}
+	revoked, err := revokeSessions(ctx, uc.sessionCollection, uc.revokedCollection, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Password changed, but other sessions could not be revoked",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed",
+		"revoked": revoked,
+	})
+}
+
+// checkPassword loads the current user and checks their password. On
+// failure it returns the status and message to answer with.
+func (uc *UserController) checkPassword(ctx context.Context, c *fiber.Ctx, password string) (*models.User, int, string) {
+	var user models.User
+	if err := uc.collection.FindOne(ctx, bson.M{"_id": auth.FromContext(c).ID()}).Decode(&user); err != nil {
+		return nil, fiber.StatusNotFound, "User not found"
+	}
+	// Accounts created through OIDC have no password until one is set
+	// with a password reset
+	if user.Password == "" {
+		return nil, fiber.StatusBadRequest, "Set a password with a password reset first"
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, fiber.StatusUnauthorized, "Current password is incorrect"
+	}
+	return &user, 0, ""
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/config"
+	"ctf-backend/markdown"
+	"ctf-backend/models"
+)
+
+type WriteupController struct {
+	collection           *mongo.Collection
+	challengeCollection  *mongo.Collection
+	submissionCollection *mongo.Collection
+	userCollection       *mongo.Collection
+}
+
+func NewWriteupController(db *mongo.Database) *WriteupController {
+	return &WriteupController{
+		collection:           db.Collection("writeups"),
+		challengeCollection:  db.Collection("challenges"),
+		submissionCollection: db.Collection("submissions"),
+		userCollection:       db.Collection("users"),
+	}
+}
+
+// SubmitWriteup stores a writeup for a challenge the caller has solved.
+// Submitting again replaces the content and puts it back into moderation.
+func (wc *WriteupController) SubmitWriteup(c *fiber.Ctx) error {
+	userID, _ := challengeCaller(c)
+
+	var input struct {
+		ChallengeID string `json:"challengeId"`
+		Content     string `json:"content"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	challengeID, err := primitive.ObjectIDFromHex(input.ChallengeID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid challenge ID",
+		})
+	}
+	if strings.TrimSpace(input.Content) == "" || len(input.Content) > models.MaxWriteupLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Content is required and must be at most 100000 bytes",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	solved, err := wc.submissionCollection.CountDocuments(ctx, bson.M{
+		"user":      userID,
+		"challenge": challengeID,
+		"isCorrect": true,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check submissions",
+		})
+	}
+	if solved == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only submit writeups for challenges you solved",
+		})
+	}
+
+	// A resubmitted writeup loses its bonus until it is approved again, so
+	// the user's score matches the scoreboard, which only counts approved
+	// writeups
+	now := time.Now()
+	filter := bson.M{"challenge": challengeID, "user": userID}
+	var before models.Writeup
+	err = wc.collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"content":     markdown.Sanitize(input.Content),
+				"status":      models.WriteupPending,
+				"bonusPoints": 0,
+				"updatedAt":   now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true),
+	).Decode(&before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save writeup",
+		})
+	}
+
+	if before.BonusPoints != 0 {
+		_, err = wc.userCollection.UpdateOne(ctx,
+			bson.M{"_id": userID},
+			bson.M{"$inc": bson.M{"score": -before.BonusPoints}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Writeup saved but its bonus points could not be withdrawn",
+			})
+		}
+	}
+
+	var writeup models.Writeup
+	if err = wc.collection.FindOne(ctx, filter).Decode(&writeup); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch writeup",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(writeup)
+}
+
+// GetMyWriteups lists the caller's writeups in every state
+func (wc *WriteupController) GetMyWriteups(c *fiber.Ctx) error {
+	userID, _ := challengeCaller(c)
+	return wc.listWriteups(c, bson.M{"user": userID})
+}
+
+// GetPublicWriteups lists approved writeups that may be shown publicly,
+// optionally for one challenge.
+func (wc *WriteupController) GetPublicWriteups(c *fiber.Ctx) error {
+	filter := bson.M{"status": models.WriteupApproved}
+
+	if id := c.Query("challengeId"); id != "" {
+		challengeID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid challenge ID",
+			})
+		}
+		filter["challenge"] = challengeID
+	}
+
+	// Before the event ends only writeups of retired challenges are public
+	if !config.EventEnded() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		retired, err := wc.challengeCollection.Distinct(ctx, "_id", bson.M{"isActive": false})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch writeups",
+			})
+		}
+		if retired == nil {
+			retired = []interface{}{}
+		}
+		if challengeID, ok := filter["challenge"]; ok {
+			filter["challenge"] = bson.M{"$eq": challengeID, "$in": retired}
+		} else {
+			filter["challenge"] = bson.M{"$in": retired}
+		}
+	}
+
+	return wc.listWriteups(c, filter)
+}
+
+// GetWriteupByID returns a writeup to its owner and admins, and to everyone
+// else once it is approved and public.
+func (wc *WriteupController) GetWriteupByID(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid writeup ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var writeup models.Writeup
+	err = wc.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&writeup)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Writeup not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch writeup",
+		})
+	}
+
+	userID, isAdmin := challengeCaller(c)
+	if isAdmin || (!userID.IsZero() && writeup.UserID == userID) {
+		return c.JSON(writeup)
+	}
+
+	public := writeup.Status == models.WriteupApproved
+	if public && !config.EventEnded() {
+		retired, err := wc.challengeCollection.CountDocuments(ctx, bson.M{"_id": writeup.ChallengeID, "isActive": false})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch writeup",
+			})
+		}
+		public = retired > 0
+	}
+	if !public {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Writeup not found",
+		})
+	}
+
+	return c.JSON(writeup)
+}
+
+// GetPendingWriteups lists writeups waiting for moderation (admin view)
+func (wc *WriteupController) GetPendingWriteups(c *fiber.Ctx) error {
+	return wc.listWriteups(c, bson.M{"status": models.WriteupPending})
+}
+
+// ModerateWriteup approves or rejects a writeup. Approved writeups may carry
+// bonus points, which are added to the author's score; changing the bonus
+// later only applies the difference. Resubmitting withdraws the bonus.
+func (wc *WriteupController) ModerateWriteup(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid writeup ID",
+		})
+	}
+
+	var input struct {
+		Status      string `json:"status"`
+		Note        string `json:"note"`
+		BonusPoints int    `json:"bonusPoints"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if input.Status != models.WriteupApproved && input.Status != models.WriteupRejected {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be approved or rejected",
+		})
+	}
+	if input.BonusPoints < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "bonusPoints must not be negative",
+		})
+	}
+	if input.Status == models.WriteupRejected {
+		input.BonusPoints = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	moderatorID, _ := challengeCaller(c)
+	var before models.Writeup
+	err = wc.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{
+			"status":         input.Status,
+			"moderationNote": input.Note,
+			"moderator":      moderatorID,
+			"bonusPoints":    input.BonusPoints,
+			"updatedAt":      time.Now(),
+		}},
+	).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Writeup not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to moderate writeup",
+		})
+	}
+
+	if delta := input.BonusPoints - before.BonusPoints; delta != 0 {
+		_, err = wc.userCollection.UpdateOne(ctx,
+			bson.M{"_id": before.UserID},
+			bson.M{"$inc": bson.M{"score": delta}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Writeup moderated but bonus points could not be awarded",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Writeup " + input.Status,
+	})
+}
+
+func (wc *WriteupController) listWriteups(c *fiber.Ctx, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+	cursor, err := wc.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch writeups",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	writeups := []models.Writeup{}
+	if err = cursor.All(ctx, &writeups); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decode writeups",
+		})
+	}
+
+	return c.JSON(writeups)
+}
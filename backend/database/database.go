@@ -4,21 +4,37 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/models"
 )
 
 var (
-	Client      *mongo.Client
-	DB          *mongo.Database
-	Users       *mongo.Collection
-	Challenges  *mongo.Collection
-	Submissions *mongo.Collection
-	Teams       *mongo.Collection
-	Scoreboard  *mongo.Collection
+	Client       *mongo.Client
+	DB           *mongo.Database
+	Users        *mongo.Collection
+	Challenges   *mongo.Collection
+	Submissions  *mongo.Collection
+	Teams        *mongo.Collection
+	Scoreboard   *mongo.Collection
+	Revisions    *mongo.Collection
+	Feedback     *mongo.Collection
+	Writeups     *mongo.Collection
+	Categories   *mongo.Collection
+	TeamRequests *mongo.Collection
+	Brackets     *mongo.Collection
+	Sessions     *mongo.Collection
+	RevokedJTIs  *mongo.Collection
+	Resets       *mongo.Collection
+	OIDCLogins   *mongo.Collection
+	APITokens    *mongo.Collection
+	AuditLogs    *mongo.Collection
 )
 
 func InitDB() {
@@ -59,13 +75,310 @@ func InitDB() {
 	Submissions = DB.Collection("submissions")
 	Teams = DB.Collection("teams")
 	Scoreboard = DB.Collection("scoreboard")
+	Revisions = DB.Collection("challenge_revisions")
+	Feedback = DB.Collection("feedback")
+	Writeups = DB.Collection("writeups")
+	Categories = DB.Collection("categories")
+	TeamRequests = DB.Collection("team_requests")
+	Brackets = DB.Collection("brackets")
+	Sessions = DB.Collection("sessions")
+	RevokedJTIs = DB.Collection("revoked_tokens")
+	Resets = DB.Collection("password_resets")
+	OIDCLogins = DB.Collection("oidc_logins")
+	APITokens = DB.Collection("api_tokens")
+	AuditLogs = DB.Collection("audit_logs")
 
 	log.Println("Successfully connected to MongoDB!")
 
 	// Create indexes
+	dedupeSolves()
+	backfillTeamCredit()
+	backfillUserTeams()
+	seedCategories()
 	createIndexes()
 }
 
+// dedupeSolves keeps the earliest correct submission of each user and
+// challenge. Solves used to be checked on the wrong fields, so older data can
+// hold repeated solves that would keep the unique solve index from building.
+// The solve counters on users and challenges are then rebuilt from the
+// submissions that are left.
+func dedupeSolves() {
+	ctx := context.Background()
+	cursor, err := Submissions.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"isCorrect": true}}},
+		bson.D{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"user": "$user", "challenge": "$challenge"},
+			"solves": bson.M{"$push": "$_id"},
+			"count":  bson.M{"$sum": 1},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		log.Printf("Error finding repeated solves: %v", err)
+		return
+	}
+	var repeated []struct {
+		Solves []primitive.ObjectID `bson:"solves"`
+	}
+	if err := cursor.All(ctx, &repeated); err != nil {
+		log.Printf("Error finding repeated solves: %v", err)
+		return
+	}
+
+	var removed int64
+	for _, group := range repeated {
+		result, err := Submissions.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.Solves[1:]}})
+		if err != nil {
+			log.Printf("Error removing repeated solves: %v", err)
+			return
+		}
+		removed += result.DeletedCount
+	}
+	if removed > 0 {
+		log.Printf("Removed %d repeated solves", removed)
+	}
+
+	if err := rebuildSolveCounters(ctx); err != nil {
+		log.Printf("Error rebuilding solve counters: %v", err)
+	}
+}
+
+// rebuildSolveCounters sets users.score, users.solvedChallenges and
+// challenges.solves from the correct submissions and approved writeup
+// bonuses. Only documents that are out of step are written.
+func rebuildSolveCounters(ctx context.Context) error {
+	cursor, err := Submissions.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"isCorrect": true}}},
+		bson.D{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":   "$user",
+			"score": bson.M{"$sum": "$pointsAwarded"},
+			"solved": bson.M{"$push": bson.M{
+				"challenge": "$challenge",
+				"solvedAt":  "$createdAt",
+				"points":    "$pointsAwarded",
+			}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	var solvers []struct {
+		ID     primitive.ObjectID       `bson:"_id"`
+		Score  int                      `bson:"score"`
+		Solved []models.SolvedChallenge `bson:"solved"`
+	}
+	if err := cursor.All(ctx, &solvers); err != nil {
+		return err
+	}
+	expected := map[primitive.ObjectID]models.User{}
+	for _, solver := range solvers {
+		expected[solver.ID] = models.User{Score: solver.Score, SolvedChallenges: solver.Solved}
+	}
+
+	cursor, err = Writeups.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"status": models.WriteupApproved, "bonusPoints": bson.M{"$gt": 0}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$user", "bonus": bson.M{"$sum": "$bonusPoints"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var bonuses []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Bonus int                `bson:"bonus"`
+	}
+	if err := cursor.All(ctx, &bonuses); err != nil {
+		return err
+	}
+	for _, bonus := range bonuses {
+		user := expected[bonus.ID]
+		user.Score += bonus.Bonus
+		expected[bonus.ID] = user
+	}
+
+	opts := options.Find().SetProjection(bson.M{"score": 1, "solvedChallenges": 1})
+	cursor, err = Users.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return err
+	}
+	for _, user := range users {
+		want := expected[user.ID]
+		if want.SolvedChallenges == nil {
+			want.SolvedChallenges = []models.SolvedChallenge{}
+		}
+		if user.Score == want.Score && sameSolves(user.SolvedChallenges, want.SolvedChallenges) {
+			continue
+		}
+		_, err := Users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+			"score":            want.Score,
+			"solvedChallenges": want.SolvedChallenges,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor, err = Submissions.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"isCorrect": true}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$challenge", "solves": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		Solves int                `bson:"solves"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return err
+	}
+	solves := map[primitive.ObjectID]int{}
+	for _, count := range counts {
+		solves[count.ID] = count.Solves
+	}
+
+	cursor, err = Challenges.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"solves": 1}))
+	if err != nil {
+		return err
+	}
+	var challenges []models.Challenge
+	if err := cursor.All(ctx, &challenges); err != nil {
+		return err
+	}
+	for _, challenge := range challenges {
+		if challenge.Solves == solves[challenge.ID] {
+			continue
+		}
+		_, err := Challenges.UpdateOne(ctx,
+			bson.M{"_id": challenge.ID},
+			bson.M{"$set": bson.M{"solves": solves[challenge.ID]}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameSolves(a, b []models.SolvedChallenge) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ChallengeID != b[i].ChallengeID || a[i].Points != b[i].Points || !a[i].SolvedAt.Equal(b[i].SolvedAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// backfillTeamCredit marks the first solve of each team and challenge made
+// before solves carried the team's credit, so the unique credit index holds
+// and those challenges are not credited to the team again
+func backfillTeamCredit() {
+	ctx := context.Background()
+	cursor, err := Submissions.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"isCorrect": true, "team": bson.M{"$exists": true}}}},
+		bson.D{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"team": "$team", "challenge": "$challenge"},
+			"first":    bson.M{"$first": "$_id"},
+			"credited": bson.M{"$max": "$teamCredit"},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"credited": bson.M{"$ne": true}}}},
+	})
+	if err != nil {
+		log.Printf("Error finding uncredited team solves: %v", err)
+		return
+	}
+	var uncredited []struct {
+		First primitive.ObjectID `bson:"first"`
+	}
+	if err := cursor.All(ctx, &uncredited); err != nil {
+		log.Printf("Error finding uncredited team solves: %v", err)
+		return
+	}
+	for _, solve := range uncredited {
+		if _, err := Submissions.UpdateOne(ctx, bson.M{"_id": solve.First}, bson.M{"$set": bson.M{"teamCredit": true}}); err != nil {
+			log.Printf("Error marking team credit on submission %s: %v", solve.First.Hex(), err)
+		}
+	}
+}
+
+// backfillUserTeams sets users.team for members of teams created before
+// users carried their team, so joining a second team is refused the same
+// way for everyone. A user listed in several teams keeps the first; the
+// members index then refuses to build until that is resolved by hand.
+func backfillUserTeams() {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.M{"createdAt": 1}).SetProjection(bson.M{"members": 1})
+	cursor, err := Teams.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Printf("Error finding team members: %v", err)
+		return
+	}
+	var teams []models.Team
+	if err := cursor.All(ctx, &teams); err != nil {
+		log.Printf("Error finding team members: %v", err)
+		return
+	}
+	for _, team := range teams {
+		_, err := Users.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": team.Members}, "team": nil},
+			bson.M{"$set": bson.M{"team": team.ID}},
+		)
+		if err != nil {
+			log.Printf("Error setting team %s on its members: %v", team.ID.Hex(), err)
+		}
+	}
+}
+
+// seedCategories adds a category for every name challenges already use.
+// Categories used to be free text on challenges, so an upgraded database
+// would otherwise reject all of them. New ones are ordered after the rest.
+func seedCategories() {
+	ctx := context.Background()
+	names, err := Challenges.Distinct(ctx, "category", bson.M{})
+	if err != nil {
+		log.Printf("Error finding challenge categories: %v", err)
+		return
+	}
+	order, err := Categories.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Error counting categories: %v", err)
+		return
+	}
+	for _, raw := range names {
+		name, ok := raw.(string)
+		if !ok || name == "" {
+			continue
+		}
+		now := time.Now()
+		result, err := Categories.UpdateOne(ctx,
+			bson.M{"name": name},
+			bson.M{"$setOnInsert": bson.M{"name": name, "order": order, "createdAt": now, "updatedAt": now}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Error adding category %q: %v", name, err)
+			continue
+		}
+		if result.UpsertedCount > 0 {
+			order++
+		}
+	}
+}
+
+// createIndexes builds the indexes, several of which enforce invariants such
+// as one solve per user and challenge. The server refuses to start without
+// them.
 func createIndexes() {
 	// User indexes
 	_, err := Users.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
@@ -77,9 +390,17 @@ func createIndexes() {
 			Keys:    bson.D{{Key: "email", Value: 1}},
 			Options: options.Index().SetUnique(true),
 		},
+		{
+			Keys: bson.D{{Key: "team", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "oidc.issuer", Value: 1}, {Key: "oidc.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"oidc": bson.M{"$exists": true}}),
+		},
 	})
 	if err != nil {
-		log.Printf("Error creating user indexes: %v", err)
+		log.Fatalf("Error creating user indexes: %v", err)
 	}
 
 	// Challenge indexes
@@ -87,19 +408,204 @@ func createIndexes() {
 		{
 			Keys: bson.D{{Key: "category", Value: 1}, {Key: "difficulty", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+		},
+		{
+			Keys: bson.D{{Key: "tags", Value: 1}},
+		},
 	})
 	if err != nil {
-		log.Printf("Error creating challenge indexes: %v", err)
+		log.Fatalf("Error creating challenge indexes: %v", err)
 	}
 
-	// Submission indexes
+	// Submission indexes. A user solves a challenge once, and one solve per
+	// team and challenge carries the team's credit.
 	_, err = Submissions.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "user", Value: 1}, {Key: "challenge", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "challenge", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("user_challenge_solved").
+				SetPartialFilterExpression(bson.M{"isCorrect": true}),
+		},
+		{
+			Keys: bson.D{{Key: "team", Value: 1}, {Key: "challenge", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("team_challenge_credit").
+				SetPartialFilterExpression(bson.M{"teamCredit": true}),
+		},
+		{
+			Keys: bson.D{{Key: "challenge", Value: 1}, {Key: "isCorrect", Value: 1}, {Key: "createdAt", Value: 1}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating submission indexes: %v", err)
+	}
+
+	// Category index
+	_, err = Categories.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatalf("Error creating category index: %v", err)
+	}
+
+	// Challenge revision index
+	_, err = Revisions.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "challenge", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		log.Fatalf("Error creating challenge revision index: %v", err)
+	}
+
+	// Feedback index, one rating per user and challenge
+	_, err = Feedback.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "challenge", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatalf("Error creating feedback index: %v", err)
+	}
+
+	// Writeup indexes, one writeup per user and challenge
+	_, err = Writeups.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "challenge", Value: 1}, {Key: "user", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating writeup indexes: %v", err)
+	}
+
+	// Team indexes. Names are unique ignoring case, and the multikey index on
+	// members guarantees that a user appears in at most one team.
+	_, err = Teams.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+		{
+			Keys:    bson.D{{Key: "members", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating team indexes: %v", err)
+	}
+
+	// Team request indexes, at most one pending request per user and team
+	_, err = TeamRequests.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "team", Value: 1}, {Key: "user", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating team request indexes: %v", err)
+	}
+
+	// Bracket index
+	_, err = Brackets.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatalf("Error creating bracket index: %v", err)
+	}
+
+	// Session indexes. Expired sessions are dropped by a TTL index.
+	_, err = Sessions.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "previousTokenHash", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "lastUsedAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating session indexes: %v", err)
+	}
+
+	// Access token denylist, entries disappear once the token has expired
+	_, err = RevokedJTIs.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Fatalf("Error creating revoked token index: %v", err)
+	}
+
+	// Password reset indexes, expired resets are dropped by a TTL index
+	_, err = Resets.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating password reset indexes: %v", err)
+	}
+
+	// Pending OIDC logins, dropped once expired
+	_, err = OIDCLogins.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Fatalf("Error creating OIDC login index: %v", err)
+	}
+
+	// API token indexes
+	_, err = APITokens.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating API token indexes: %v", err)
+	}
+
+	// Audit log indexes
+	_, err = AuditLogs.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "target", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
 	})
 	if err != nil {
-		log.Printf("Error creating submission indexes: %v", err)
+		log.Fatalf("Error creating audit log indexes: %v", err)
 	}
 
 	// Scoreboard index
@@ -107,7 +613,7 @@ func createIndexes() {
 		Keys: bson.D{{Key: "score", Value: -1}, {Key: "lastSolve", Value: 1}},
 	})
 	if err != nil {
-		log.Printf("Error creating scoreboard index: %v", err)
+		log.Fatalf("Error creating scoreboard index: %v", err)
 	}
 }
 
@@ -0,0 +1,240 @@
+// Package mailer sends transactional email such as address verification.
+//
+// MAIL_DRIVER selects the implementation: "smtp" sends through SMTP_HOST,
+// "file" writes each message to MAIL_DIR, and "log" prints messages to the
+// server log for local development. Messages carry login tokens, so they
+// are only logged when asked for; without MAIL_DRIVER nothing is sent.
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer Mailer
+)
+
+// Default returns the mailer configured by the environment
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		defaultMailer = FromEnv()
+	})
+	return defaultMailer
+}
+
+// FromEnv builds a mailer from MAIL_DRIVER and its settings
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "noreply@localhost"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(os.Getenv("SMTP_HOST"), port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "file":
+		return &FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+	case "log":
+		return &FileMailer{From: from}
+	default:
+		log.Printf("Warning: MAIL_DRIVER is %q, no email will be sent. Set it to smtp, file or log.", os.Getenv("MAIL_DRIVER"))
+		return unconfiguredMailer{}
+	}
+}
+
+// ErrNotConfigured is returned for every message when MAIL_DRIVER is unset
+// or unknown
+var ErrNotConfigured = errors.New("mail is not configured")
+
+type unconfiguredMailer struct{}
+
+func (unconfiguredMailer) Send(ctx context.Context, msg Message) error {
+	return ErrNotConfigured
+}
+
+// SMTPMailer sends mail through an SMTP server, using STARTTLS when the
+// server offers it.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The deadline bounds the whole exchange, and cancelling the context
+	// closes the connection so a stalled server cannot hold the caller
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := m.send(conn, msg); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+// send runs the SMTP exchange of smtp.SendMail over an open connection
+func (m *SMTPMailer) send(conn net.Conn, msg Message) error {
+	host, _, _ := net.SplitHostPort(m.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(encode(m.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileMailer writes each message as an .eml file to Dir, or to the log
+// when Dir is empty. It is meant for development and tests.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu sync.Mutex
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data := encode(m.From, msg)
+	if m.Dir == "" {
+		log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeName(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// encode renders a message as MIME, multipart when it has an HTML body
+func encode(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(msg.Text)
+		return []byte(b.String())
+	}
+
+	const boundary = "ctf-mail-boundary"
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, msg.Text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, msg.HTML)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return []byte(b.String())
+}
+
+// header drops line breaks so values cannot inject extra headers
+func header(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
+
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
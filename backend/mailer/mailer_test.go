@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderOverride(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "verify_email.subject.tmpl"), []byte("Welcome to {{.EventName}}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MAIL_TEMPLATES_DIR", dir)
+	t.Setenv("EVENT_NAME", "GIS CTF")
+
+	msg, err := Render("verify_email", "a@example.com", map[string]interface{}{
+		"Username":  "alice",
+		"URL":       "https://ctf.example/verify?token=x&y=<z>",
+		"ExpiresIn": "24h0m0s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Welcome to GIS CTF" {
+		t.Errorf("Subject = %q, want override", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "token=x&y=<z>") {
+		t.Errorf("Text does not contain the raw URL: %q", msg.Text)
+	}
+	if strings.Contains(msg.HTML, "<z>") {
+		t.Errorf("HTML does not escape the URL: %q", msg.HTML)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "ctf@example.com"}
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi", Text: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one message file, got %v (%v)", files, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if !strings.Contains(string(data), "Subject: Hi") {
+		t.Errorf("message = %q", data)
+	}
+}
+
+func TestFromEnvNeverLogsByDefault(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "")
+	if err := FromEnv().Send(context.Background(), Message{To: "a@example.com"}); err != ErrNotConfigured {
+		t.Errorf("Send without MAIL_DRIVER = %v, want ErrNotConfigured", err)
+	}
+
+	t.Setenv("MAIL_DRIVER", "log")
+	if m, ok := FromEnv().(*FileMailer); !ok || m.Dir != "" {
+		t.Errorf("MAIL_DRIVER=log gave %#v", m)
+	}
+}
+
+func TestSMTPMailerStopsAtDeadline(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	m := &SMTPMailer{Addr: ln.Addr().String(), From: "ctf@example.com"}
+	done := make(chan error, 1)
+	go func() { done <- m.Send(ctx, Message{To: "a@example.com", Subject: "Hi", Text: "Hello"}) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Send = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not return after the context deadline")
+	}
+}
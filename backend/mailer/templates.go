@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"ctf-backend/config"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Render builds a message from the templates named name.subject.tmpl,
+// name.txt.tmpl and name.html.tmpl. A file of the same name in
+// MAIL_TEMPLATES_DIR replaces the built in one, so each event can brand its
+// own emails. EventName is added to data from EVENT_NAME.
+func Render(name, to string, data map[string]interface{}) (Message, error) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	if _, ok := data["EventName"]; !ok {
+		data["EventName"] = config.EventName()
+	}
+
+	msg := Message{To: to}
+
+	subject, err := renderText(name+".subject.tmpl", data)
+	if err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(subject)
+
+	if msg.Text, err = renderText(name+".txt.tmpl", data); err != nil {
+		return msg, err
+	}
+
+	// The HTML part is optional
+	source, err := loadTemplate(name + ".html.tmpl")
+	if err != nil {
+		return msg, nil
+	}
+	tmpl, err := htmltemplate.New(name).Parse(source)
+	if err != nil {
+		return msg, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return msg, err
+	}
+	msg.HTML = buf.String()
+
+	return msg, nil
+}
+
+func renderText(file string, data map[string]interface{}) (string, error) {
+	source, err := loadTemplate(file)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := texttemplate.New(file).Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func loadTemplate(file string) (string, error) {
+	if dir := os.Getenv("MAIL_TEMPLATES_DIR"); dir != "" {
+		if data, err := os.ReadFile(filepath.Join(dir, file)); err == nil {
+			return string(data), nil
+		}
+	}
+	data, err := defaultTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 
+	"ctf-backend/auth"
 	"ctf-backend/database"
 	"ctf-backend/routes"
 )
@@ -18,6 +19,11 @@ func main() {
 	database.InitDB()
 	defer database.CloseDB()
 
+	// Refuse to start without a key to sign and verify tokens
+	if err := auth.Init(); err != nil {
+		log.Fatalf("JWT keys: %v", err)
+	}
+
 	// Create Fiber app
 	app := fiber.New()
 
@@ -25,9 +31,10 @@ func main() {
 	app.Use(logger.New())
 	app.Use(recover.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, If-Match",
+		AllowMethods:  "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+		ExposeHeaders: "ETag",
 	}))
 
 	// Root route
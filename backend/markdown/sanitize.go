@@ -0,0 +1,444 @@
+// Package markdown cleans user-submitted Markdown before it is stored and
+// served. Raw HTML is neutralised and link and image targets are limited
+// to safe schemes, so clients can render the result without further
+// filtering. Code blocks and code spans are left as written.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// [ref]: url "title", with the url on the same or the next line
+var referenceLink = regexp.MustCompile(`(?m)^( {0,3}\[[^\]]+\]:[ \t]*\n?[ \t]*)<?(\S*?)>?((?:[ \t]+.*)?)$`)
+
+var (
+	// ``` or ~~~ with an optional info string, after the indentation
+	fenceLine = regexp.MustCompile("^(`{3,}|~{3,})(.*)$")
+	// List items and footnotes, whose indented lines are not code blocks
+	listMarker = regexp.MustCompile(`^([-+*]|\d{1,9}[.)]|\[\^[^\]]*\]:)([ \t]|$)`)
+)
+
+// Sanitize returns a copy of src that is safe to render
+func Sanitize(src string) string {
+	// Normalise line endings and drop NUL bytes
+	out := strings.ReplaceAll(src, "\r\n", "\n")
+	out = strings.ReplaceAll(out, "\x00", "")
+
+	var b strings.Builder
+	for _, block := range splitCodeBlocks(out) {
+		if block.code {
+			b.WriteString(block.text)
+		} else {
+			b.WriteString(sanitizeProse(block.text))
+		}
+	}
+	return b.String()
+}
+
+// sanitizeProse cleans everything outside code blocks. Code spans are kept
+// as they are, since renderers show their content literally.
+func sanitizeProse(s string) string {
+	s = referenceLink.ReplaceAllStringFunc(s, func(m string) string {
+		parts := referenceLink.FindStringSubmatch(m)
+		return parts[1] + safeURL(parts[2], false) + parts[3]
+	})
+
+	var b strings.Builder
+	for _, para := range splitParagraphs(s) {
+		pos := 0
+		for _, span := range codeSpans(para) {
+			b.WriteString(sanitizeText(para[pos:span[0]]))
+			b.WriteString(para[span[0]:span[1]])
+			pos = span[1]
+		}
+		b.WriteString(sanitizeText(para[pos:]))
+	}
+	return b.String()
+}
+
+func sanitizeText(s string) string {
+	// Escaping every '<' turns HTML tags, comments and autolinks into text
+	return sanitizeInlineLinks(strings.ReplaceAll(s, "<", "&lt;"))
+}
+
+type block struct {
+	text string
+	code bool
+}
+
+// splitCodeBlocks separates fenced and indented code blocks from the rest.
+// A line is only taken as code when every renderer reads it that way;
+// anything a container such as a list could change is left as prose, and
+// once a fence can no longer be told apart the rest of the text is prose.
+func splitCodeBlocks(s string) []block {
+	var blocks []block
+	add := func(text string, code bool) {
+		if n := len(blocks); n > 0 && blocks[n-1].code == code {
+			blocks[n-1].text += text
+			return
+		}
+		blocks = append(blocks, block{text, code})
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	inList := false
+	prevBlank := true
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			add(line, false)
+			prevBlank = true
+			continue
+		}
+		cols, rest := indentation(line)
+
+		if cols <= 3 {
+			if m := fenceLine.FindStringSubmatch(strings.TrimSuffix(rest, "\n")); m != nil && !(m[1][0] == '`' && strings.Contains(m[2], "`")) {
+				end, ok := fenceEnd(lines, i, cols, m[1])
+				if !ok {
+					add(strings.Join(lines[i:], ""), false)
+					break
+				}
+				add(strings.Join(lines[i:end], ""), true)
+				i = end - 1
+				prevBlank = false
+				continue
+			}
+		}
+
+		if cols >= 4 && prevBlank && !inList {
+			end := i
+			for end < len(lines) && (isBlank(lines[end]) || leadingColumns(lines[end]) >= 4) {
+				end++
+			}
+			add(strings.Join(lines[i:end], ""), true)
+			i = end - 1
+			prevBlank = isBlank(lines[end-1])
+			continue
+		}
+
+		marker := cols <= 3 && listMarker.MatchString(rest)
+		if marker {
+			inList = true
+		} else if prevBlank && cols <= 1 {
+			// Every list item is indented by at least two columns
+			inList = false
+		}
+		add(line, false)
+		prevBlank = false
+	}
+	return blocks
+}
+
+// fenceEnd returns the end of the fenced block opened on lines[open] with
+// the given indentation. An opener indented by one to three columns may sit
+// in a list item, which would move where the block ends; ok is false when
+// that makes the end uncertain.
+func fenceEnd(lines []string, open, indent int, fence string) (end int, ok bool) {
+	for j := open + 1; j < len(lines); j++ {
+		if isBlank(lines[j]) {
+			continue
+		}
+		cols, rest := indentation(lines[j])
+		closer := strings.HasPrefix(rest, fence) && strings.Trim(strings.TrimLeft(rest, fence[:1]), " \t\n") == ""
+		switch {
+		case cols < indent:
+			return 0, false
+		case closer && cols <= 3:
+			return j + 1, true
+		case closer && indent > 0 && cols <= indent+3:
+			return 0, false
+		}
+	}
+	return len(lines), true
+}
+
+// splitParagraphs cuts s at blank lines, which end every inline context
+func splitParagraphs(s string) []string {
+	var paras []string
+	start, end := 0, 0
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if isBlank(line) {
+			if end > start {
+				paras = append(paras, s[start:end])
+			}
+			paras = append(paras, line)
+			start = end + len(line)
+		}
+		end += len(line)
+	}
+	if start < len(s) {
+		paras = append(paras, s[start:])
+	}
+	return paras
+}
+
+// codeSpans returns the code spans of a paragraph as [start, end) offsets
+// including the backticks. It returns none when a renderer could pair the
+// backticks differently: when a span runs over several lines, whose block
+// structure may split it, or when a backtick sits in what may be a link
+// destination or title, which are read before code spans.
+func codeSpans(p string) [][2]int {
+	for i := strings.Index(p, "]("); i != -1; {
+		if strings.Contains(p[i+2:linkTailEnd(p, i+2)], "`") {
+			return nil
+		}
+		next := strings.Index(p[i+2:], "](")
+		if next == -1 {
+			break
+		}
+		i += 2 + next
+	}
+
+	var spans [][2]int
+	for i := 0; i < len(p); {
+		switch {
+		case p[i] == '\\' && i+1 < len(p) && isASCIIPunct(p[i+1]):
+			i += 2
+		case p[i] == '`':
+			n := runLength(p, i)
+			closing := -1
+			for j := i + n; j < len(p); {
+				if p[j] != '`' {
+					j++
+					continue
+				}
+				m := runLength(p, j)
+				if m == n {
+					closing = j
+					break
+				}
+				j += m
+			}
+			if closing == -1 {
+				i += n
+				continue
+			}
+			if strings.Contains(p[i:closing], "\n") {
+				return nil
+			}
+			spans = append(spans, [2]int{i, closing + n})
+			i = closing + n
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// linkTailEnd returns where the destination and title of an inline link
+// starting at s[start] would end, erring towards the end of the paragraph.
+func linkTailEnd(s string, start int) int {
+	skip := func(j int) int {
+		newline := false
+		for j < len(s) && (s[j] == ' ' || s[j] == '\t' || (s[j] == '\n' && !newline)) {
+			newline = newline || s[j] == '\n'
+			j++
+		}
+		return j
+	}
+
+	j := skip(start)
+	if j < len(s) && s[j] == '<' {
+		for j < len(s) && s[j] != '>' && s[j] != '\n' {
+			j++
+		}
+	} else {
+		depth := 0
+	dest:
+		for j < len(s) {
+			switch c := s[j]; {
+			case c == '\\' && j+1 < len(s) && isASCIIPunct(s[j+1]):
+				j++
+			case c <= ' ' || c == 0x7f:
+				break dest
+			case c == '(':
+				depth++
+			case c == ')':
+				if depth == 0 {
+					break dest
+				}
+				depth--
+			}
+			j++
+		}
+	}
+
+	j = skip(j)
+	if j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closer := s[j]
+		if closer == '(' {
+			closer = ')'
+		}
+		for j++; j < len(s) && s[j] != closer; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return len(s)
+		}
+		j = skip(j + 1)
+	}
+	if j < len(s) && s[j] == ')' {
+		j++
+	}
+	return j
+}
+
+func runLength(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// indentation returns the width of the leading whitespace of a line, with
+// tabs stopping at multiples of four, and the rest of the line
+func indentation(line string) (int, string) {
+	cols := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			cols++
+		case '\t':
+			cols += 4 - cols%4
+		default:
+			return cols, line[i:]
+		}
+	}
+	return cols, ""
+}
+
+func leadingColumns(line string) int {
+	cols, _ := indentation(line)
+	return cols
+}
+
+func isBlank(line string) bool {
+	return strings.Trim(line, " \t\n") == ""
+}
+
+// sanitizeInlineLinks rewrites the destination of every inline link and
+// image. Link text is always closed by "](", so each one is treated as the
+// start of a destination; rewriting one that is not a link is harmless.
+// Destinations are read the way CommonMark does, with backslash escapes and
+// nested balanced parentheses, and end at whitespace or an unbalanced ")".
+// Whatever follows, such as a title, is left alone.
+func sanitizeInlineLinks(s string) string {
+	var b strings.Builder
+	pos := 0
+	for {
+		i := strings.Index(s[pos:], "](")
+		if i == -1 {
+			b.WriteString(s[pos:])
+			return b.String()
+		}
+		i += pos
+
+		start := i + 2
+		for start < len(s) && (s[start] == ' ' || s[start] == '\t' || s[start] == '\n') {
+			start++
+		}
+		end := start
+		depth := 0
+	scan:
+		for end < len(s) {
+			switch c := s[end]; {
+			case c == '\\' && end+1 < len(s) && isASCIIPunct(s[end+1]):
+				end += 2
+				continue
+			case c <= ' ' || c == 0x7f:
+				break scan
+			case c == '(':
+				depth++
+			case c == ')':
+				if depth == 0 {
+					break scan
+				}
+				depth--
+			}
+			end++
+		}
+
+		b.WriteString(s[pos:start])
+		b.WriteString(safeURL(s[start:end], isImage(s, i)))
+		pos = end
+	}
+}
+
+// isImage reports whether the link text closed at s[close] was opened by
+// "![". Without a matching "[" it answers true, the stricter choice.
+func isImage(s string, close int) bool {
+	depth := 0
+	for k := close - 1; k >= 0; k-- {
+		switch s[k] {
+		case ']':
+			depth++
+		case '[':
+			if depth == 0 {
+				return k > 0 && s[k-1] == '!'
+			}
+			depth--
+		}
+	}
+	return true
+}
+
+// unescapePunct decodes Markdown backslash escapes
+func unescapePunct(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+// safeURL keeps http(s) and relative URLs. mailto is allowed for links but
+// not images. Anything else becomes "#".
+func safeURL(raw string, image bool) string {
+	url := strings.TrimSpace(raw)
+	if url == "" {
+		return "#"
+	}
+
+	// Renderers decode backslash escapes and entities in URLs. Browsers
+	// ignore whitespace and control characters inside schemes, and read
+	// backslashes as slashes.
+	compact := strings.Map(func(r rune) rune {
+		switch {
+		case r <= ' ':
+			return -1
+		case r == '\\':
+			return '/'
+		}
+		return r
+	}, strings.ToLower(html.UnescapeString(unescapePunct(url))))
+
+	switch {
+	case strings.HasPrefix(compact, "https://"), strings.HasPrefix(compact, "http://"):
+		return url
+	case !image && strings.HasPrefix(compact, "mailto:"):
+		return url
+	case strings.HasPrefix(compact, "//"):
+		return "#"
+	case strings.HasPrefix(compact, "/"), strings.HasPrefix(compact, "#"), strings.HasPrefix(compact, "./"):
+		return url
+	}
+
+	// A relative path has no scheme before its first slash
+	if i := strings.IndexAny(compact, ":/?#"); i == -1 || compact[i] != ':' {
+		return url
+	}
+	return "#"
+}
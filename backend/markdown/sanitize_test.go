@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "# Solve\n\nUse `nc`.", "# Solve\n\nUse `nc`."},
+		{"html", `<script>alert(1)</script>`, `&lt;script>alert(1)&lt;/script>`},
+		{"https link", `[docs](https://leafletjs.com "Leaflet")`, `[docs](https://leafletjs.com "Leaflet")`},
+		{"relative image", `![map](/uploads/map.png)`, `![map](/uploads/map.png)`},
+		{"javascript link", `[x](javascript:alert(1))`, `[x](#)`},
+		{"entity in scheme", `[x](&#106;avascript:alert(1))`, `[x](#)`},
+		{"parens in url", `[wiki](https://en.wikipedia.org/wiki/Geo_(disambiguation))`, `[wiki](https://en.wikipedia.org/wiki/Geo_(disambiguation))`},
+		{"data image", `![x](data:image/svg+xml;base64,AAAA)`, `![x](#)`},
+		{"mailto image", `![x](mailto:a@b.c)`, `![x](#)`},
+		{"reference", "[a]: javascript:alert(1)", "[a]: #"},
+		{"protocol relative", `[x](//evil.example)`, `[x](#)`},
+		{"single quoted title", `[x](javascript:alert(1) 'x')`, `[x](# 'x')`},
+		{"paren title", `[x](javascript:alert(1) (t))`, `[x](# (t))`},
+		{"nested parens", `[x](javascript:a((1)))`, `[x](#)`},
+		{"escaped scheme", `[x](javascript\:alert(1))`, `[x](#)`},
+		{"escaped backslashes", `[x](\\\\evil.example)`, `[x](#)`},
+		{"destination on next line", "[x](\njavascript:alert(1))", "[x](\n#)"},
+		{"nested text", `[a [b]](javascript:x)`, `[a [b]](#)`},
+		{"mailto in nested image text", `[![x](/a.png)](mailto:a@b.c)`, `[![x](/a.png)](mailto:a@b.c)`},
+		{"reference on next line", "[a]:\n  javascript:alert(1)", "[a]:\n  #"},
+		{"fenced code", "```c\n#include <stdio.h>\n[x](javascript:y)\n```\n<b>", "```c\n#include <stdio.h>\n[x](javascript:y)\n```\n&lt;b>"},
+		{"tilde fence", "~~~\na < b\n~~~", "~~~\na < b\n~~~"},
+		{"unclosed fence", "```\n<b>", "```\n<b>"},
+		{"indented code", "Run:\n\n    cat <flag.txt\n\n<b>", "Run:\n\n    cat <flag.txt\n\n&lt;b>"},
+		{"code span", "Use `a<b` or <b>", "Use `a<b` or &lt;b>"},
+		{"double backtick span", "``a`<b>``", "``a`<b>``"},
+		{"unmatched backtick", "` <b>", "` &lt;b>"},
+		{"escaped backtick", "\\` <b> `", "\\` &lt;b> `"},
+		{"span over lines", "`a\nb` <b> `", "`a\nb` &lt;b> `"},
+		{"backtick in link title", "[a](/u '`') <b>`'", "[a](/u '`') &lt;b>`'"},
+		{"backtick in link title on next line", "[a](/u 'x\n`' <b> `", "[a](/u 'x\n`' &lt;b> `"},
+		{"backtick in link destination", "[a](x`y) <b>`", "[a](x`y) &lt;b>`"},
+		{"indented list paragraph", "- a\n\n    <b>", "- a\n\n    &lt;b>"},
+		{"indented footnote paragraph", "[^1]: a\n\n    <b>", "[^1]: a\n\n    &lt;b>"},
+		{"indented paragraph continuation", "a\n    <b>", "a\n    &lt;b>"},
+		{"fence in list item", "1. x\n   ```\n<b>\n```", "1. x\n   ```\n&lt;b>\n```"},
+		{"fence after list item", "- x\n```\n<b>\n```", "- x\n```\n<b>\n```"},
+		{"backtick fence info", "``` a`b\n<b>", "``` a`b\n&lt;b>"},
+		{"indented closer", "  ```\nx\n```\n<b>\n```", "  ```\nx\n```\n&lt;b>\n```"},
+		{"quoted fence", "> ```\n> <b>\n> ```", "> ```\n> &lt;b>\n> ```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeLeavesNoTags(t *testing.T) {
+	in := `<img src=x onerror=alert(1)><a href="javascript:x">x</a><!-- c -->`
+	if got := Sanitize(in); strings.Contains(got, "<") {
+		t.Errorf("Sanitize left a tag: %q", got)
+	}
+}
@@ -1,17 +1,28 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"ctf-backend/auth"
+	"ctf-backend/database"
+	"ctf-backend/models"
 )
 
-// RequireAuth is a middleware to check if the request is authenticated
-func RequireAuth() fiber.Handler {
+// RequireAuth is a middleware to check if the request is authenticated.
+// Personal API tokens are accepted for GET requests when they have the read
+// scope, and for any request when they have one of scopes.
+func RequireAuth(scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get token from header
 		authHeader := c.Get("Authorization")
@@ -29,47 +40,211 @@ func RequireAuth() fiber.Handler {
 			})
 		}
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			secret := os.Getenv("JWT_SECRET")
-			if secret == "" {
-				log.Println("Warning: JWT_SECRET is empty!")
-			}
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		principal, status, err := authenticate(tokenString)
+		if err != nil {
 			log.Printf("Auth Error: %v", err)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid or expired token",
-				"details": err.Error(),
+			return c.Status(status).JSON(fiber.Map{
+				"error": err.Error(),
 			})
 		}
-
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims",
+		if principal.Ban.Active() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":  "Account is banned",
+				"reason": principal.Ban.Reason,
+				"until":  principal.Ban.Until,
+			})
+		}
+		if !scopeAllowed(c, principal, scopes) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API token does not have the scope for this request",
 			})
 		}
 
 		// Add user info to context
-		c.Locals("userID", claims["userID"])
-		c.Locals("isAdmin", claims["isAdmin"] == true)
+		auth.SetPrincipal(c, principal)
+
+		return c.Next()
+	}
+}
+
+// OptionalAuth sets the principal like RequireAuth when a valid bearer
+// token is present, and lets anonymous requests through untouched.
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		if tokenString == "" {
+			return c.Next()
+		}
+
+		principal, _, err := authenticate(tokenString)
+		if err != nil || principal.Ban.Active() || !scopeAllowed(c, principal, nil) {
+			return c.Next()
+		}
+
+		auth.SetPrincipal(c, principal)
 
 		return c.Next()
 	}
 }
 
+// scopeAllowed checks a personal API token against the request. Session
+// logins are always allowed.
+func scopeAllowed(c *fiber.Ctx, principal *auth.Principal, scopes []string) bool {
+	if !principal.APIToken {
+		return true
+	}
+	if (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead) && principal.HasScope(models.ScopeRead) {
+		return true
+	}
+	for _, scope := range scopes {
+		if principal.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate verifies an access token or personal API token and resolves
+// its user. On failure it returns the status code to answer with.
+func authenticate(tokenString string) (*auth.Principal, int, error) {
+	if strings.HasPrefix(tokenString, auth.APITokenPrefix) {
+		return authenticateAPIToken(tokenString)
+	}
+
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, fiber.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+
+	// Tokens without an ID predate sessions and cannot be revoked. Purpose
+	// tokens, such as email verification links, are not access tokens.
+	jti, _ := claims["jti"].(string)
+	if _, ok := claims["purpose"]; jti == "" || ok {
+		return nil, fiber.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+	revoked, err := tokenRevoked(jti)
+	if err != nil {
+		log.Printf("Auth Error: %v", err)
+		return nil, fiber.StatusServiceUnavailable, errors.New("Could not verify token")
+	}
+	if revoked {
+		return nil, fiber.StatusUnauthorized, errors.New("Token has been revoked")
+	}
+
+	rawUserID, _ := claims["userID"].(string)
+	userID, err := primitive.ObjectIDFromHex(rawUserID)
+	if err != nil {
+		return nil, fiber.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+	rawSessionID, _ := claims["sid"].(string)
+	sessionID, err := primitive.ObjectIDFromHex(rawSessionID)
+	if err != nil {
+		return nil, fiber.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Logging out, bans and password resets end the session, which takes
+	// every access token it issued with it
+	ended, err := auth.SessionEnded(ctx, database.Sessions, sessionID)
+	if err != nil {
+		log.Printf("Auth Error: %v", err)
+		return nil, fiber.StatusServiceUnavailable, errors.New("Could not verify token")
+	}
+	if ended {
+		return nil, fiber.StatusUnauthorized, errors.New("Session has ended, please log in again")
+	}
+
+	// Role and ban state come from the database, the token's role claim is
+	// informational only
+	principal, err := auth.LoadPrincipal(ctx, database.Users, userID)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.StatusUnauthorized, errors.New("User no longer exists")
+	}
+	if err != nil {
+		log.Printf("Auth Error: %v", err)
+		return nil, fiber.StatusServiceUnavailable, errors.New("Could not verify token")
+	}
+	principal.SessionID = rawSessionID
+	principal.TokenID = jti
+
+	return principal, 0, nil
+}
+
+// authenticateAPIToken looks up a personal API token by its hash, recording
+// the use, and resolves its owner
+func authenticateAPIToken(tokenString string) (*auth.Principal, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var token models.APIToken
+	err := database.APITokens.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": auth.HashToken(tokenString),
+			"revokedAt": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"expiresAt": bson.M{"$exists": false}},
+				bson.M{"expiresAt": bson.M{"$gt": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"lastUsedAt": now},
+			"$inc": bson.M{"usageCount": 1},
+		},
+	).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.StatusUnauthorized, errors.New("Invalid, expired or revoked API token")
+	}
+	if err != nil {
+		log.Printf("Auth Error: %v", err)
+		return nil, fiber.StatusServiceUnavailable, errors.New("Could not verify token")
+	}
+
+	principal, err := auth.LoadPrincipal(ctx, database.Users, token.UserID)
+	if err == mongo.ErrNoDocuments {
+		return nil, fiber.StatusUnauthorized, errors.New("User no longer exists")
+	}
+	if err != nil {
+		log.Printf("Auth Error: %v", err)
+		return nil, fiber.StatusServiceUnavailable, errors.New("Could not verify token")
+	}
+	principal.APIToken = true
+	principal.Scopes = token.Scopes
+	principal.TokenID = token.ID.Hex()
+
+	return principal, 0, nil
+}
+
+// tokenRevoked checks the access token denylist
+func tokenRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := database.RevokedJTIs.CountDocuments(ctx, bson.M{"_id": jti}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// parseToken validates a signed JWT against the keyring and returns its
+// claims
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	return auth.Parse(tokenString)
+}
+
 // RequireAdmin is a middleware to check if the user is an admin
 func RequireAdmin() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		isAdmin, ok := c.Locals("isAdmin").(bool)
-		if !ok || !isAdmin {
+		principal := auth.FromContext(c)
+		if principal.NeedsTwoFactor() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Enable two-factor authentication to use admin access",
+			})
+		}
+		if !principal.IsAdmin() {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "Admin access required",
 			})
@@ -77,3 +252,15 @@ func RequireAdmin() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// RequireAuthor is a middleware to check if the user can author challenges
+func RequireAuthor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !auth.FromContext(c).CanAuthor() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Author access required",
+			})
+		}
+		return c.Next()
+	}
+}
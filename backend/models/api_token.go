@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// API token scopes
+const (
+	ScopeRead   = "read"
+	ScopeSubmit = "submit"
+)
+
+// APITokenScopes lists the scopes a token can be given
+var APITokenScopes = []string{ScopeRead, ScopeSubmit}
+
+// APIToken is a personal access token for scripts. Only the hash of the
+// token is stored; Prefix keeps its first characters so owners can tell
+// tokens apart.
+type APIToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user" json:"userId"`
+	Name       string             `bson:"name" json:"name" validate:"required,max=50"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	TokenHash  string             `bson:"tokenHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	UsageCount int64              `bson:"usageCount" json:"usageCount"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func (t *APIToken) BeforeCreate() {
+	t.CreatedAt = time.Now()
+}
+
+// Active reports whether the token can still be used
+func (t *APIToken) Active() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit log actions for admin user management
+const (
+	AuditUserRole          = "user.role"
+	AuditUserBan           = "user.ban"
+	AuditUserUnban         = "user.unban"
+	AuditUserHide          = "user.hide"
+	AuditUserUnhide        = "user.unhide"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserScoreReset    = "user.score_reset"
+	AuditUserDelete        = "user.delete"
+)
+
+// AuditLog records an action an admin took. TargetName keeps the name of
+// the target so entries stay readable after it is deleted.
+type AuditLog struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	ActorID    primitive.ObjectID     `bson:"actor" json:"actorId"`
+	ActorName  string                 `bson:"actorName" json:"actorName"`
+	Action     string                 `bson:"action" json:"action"`
+	TargetID   primitive.ObjectID     `bson:"target" json:"targetId"`
+	TargetName string                 `bson:"targetName" json:"targetName"`
+	Details    map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt  time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+func (a *AuditLog) BeforeCreate() {
+	a.CreatedAt = time.Now()
+}
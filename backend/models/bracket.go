@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bracket is an admin-defined division, e.g. "Students" or "Open". Users
+// and teams pick one at registration and are ranked within it.
+type Bracket struct {
+	ID                   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name                 string             `bson:"name" json:"name" validate:"required,max=40"`
+	Description          string             `bson:"description,omitempty" json:"description,omitempty"`
+	RequiresVerification bool               `bson:"requiresVerification" json:"requiresVerification"`
+	Order                int                `bson:"order" json:"order"`
+	CreatedAt            time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt            time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (b *Bracket) BeforeCreate() {
+	timeNow := time.Now()
+	b.CreatedAt = timeNow
+	b.UpdatedAt = timeNow
+}
+
+// Validate trims the name and requires it to be 1 to 40 bytes
+func (b *Bracket) Validate() error {
+	b.Name = strings.TrimSpace(b.Name)
+	if b.Name == "" || len(b.Name) > 40 {
+		return errors.New("name is required and must be at most 40 characters")
+	}
+	return nil
+}
+
+// BracketMembership is the bracket a user or team registered for. It only
+// counts for bracket scoreboards once Verified is set.
+type BracketMembership struct {
+	BracketID primitive.ObjectID `bson:"id" json:"id"`
+	Verified  bool               `bson:"verified" json:"verified"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultCategories are seeded into a fresh database, in display order
+var DefaultCategories = []string{"Web", "Cryptography", "Forensics", "Reverse Engineering", "PWN", "Misc", "GIS"}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Category is an admin-managed challenge category. Challenges reference it
+// by name.
+type Category struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string             `bson:"name" json:"name" validate:"required,max=40"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Color       string             `bson:"color,omitempty" json:"color,omitempty" validate:"omitempty,hexcolor"`
+	Order       int                `bson:"order" json:"order"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (c *Category) BeforeCreate() {
+	timeNow := time.Now()
+	c.CreatedAt = timeNow
+	c.UpdatedAt = timeNow
+}
+
+// Validate trims the name, which must be 1 to 40 bytes, and accepts an
+// empty color or a #rrggbb hex one
+func (c *Category) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" || len(c.Name) > 40 {
+		return errors.New("name is required and must be at most 40 characters")
+	}
+	if c.Color != "" && !colorPattern.MatchString(c.Color) {
+		return errors.New("color must be a hex color like #1e90ff")
+	}
+	return nil
+}
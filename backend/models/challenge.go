@@ -1,8 +1,15 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -35,22 +42,34 @@ type Hint struct {
 	PointsPenalty int    `bson:"pointsPenalty" json:"pointsPenalty"`
 }
 
+// Challenge workflow states. Challenges without a status predate the
+// workflow and are treated as published.
+const (
+	ChallengeDraft     = "draft"
+	ChallengeReview    = "review"
+	ChallengePublished = "published"
+)
+
 type Challenge struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Title       string             `bson:"title" json:"title" validate:"required"`
-	Description string             `bson:"description" json:"description" validate:"required"`
-	Category    string             `bson:"category" json:"category" validate:"required,oneof=Web Cryptography Forensics 'Reverse Engineering' PWN Misc GIS"`
-	Difficulty  string             `bson:"difficulty" json:"difficulty" validate:"required,oneof=Easy Medium Hard Expert"`
-	Points      int                `bson:"points" json:"points" validate:"required,min=0"`
-	Flag        string             `bson:"flag" json:"-" validate:"required"`
-	Hints       []Hint             `bson:"hints,omitempty" json:"hints,omitempty"`
-	MapConfig   *MapConfig         `bson:"mapConfig,omitempty" json:"mapConfig,omitempty"`
-	Files       []File             `bson:"files,omitempty" json:"files,omitempty"`
-	IsActive    bool               `bson:"isActive" json:"isActive"`
-	AuthorID    primitive.ObjectID `bson:"author" json:"authorId" validate:"required"`
-	Solves      int                `bson:"solves" json:"solves"`
-	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Title       string              `bson:"title" json:"title" validate:"required"`
+	Description string              `bson:"description" json:"description" validate:"required"`
+	Category    string              `bson:"category" json:"category" validate:"required"`
+	Difficulty  string              `bson:"difficulty" json:"difficulty" validate:"required,oneof=Easy Medium Hard Expert"`
+	Points      int                 `bson:"points" json:"points" validate:"required,min=0"`
+	Flag        string              `bson:"flag" json:"-" validate:"required"`
+	Tags        []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	Hints       []Hint              `bson:"hints,omitempty" json:"hints,omitempty"`
+	MapConfig   *MapConfig          `bson:"mapConfig,omitempty" json:"mapConfig,omitempty"`
+	Files       []File              `bson:"files,omitempty" json:"files,omitempty"`
+	IsActive    bool                `bson:"isActive" json:"isActive"`
+	AuthorID    primitive.ObjectID  `bson:"author" json:"authorId" validate:"required"`
+	Status      string              `bson:"status,omitempty" json:"status,omitempty" validate:"omitempty,oneof=draft review published"`
+	ReviewerID  *primitive.ObjectID `bson:"reviewer,omitempty" json:"reviewerId,omitempty"`
+	ReviewNote  string              `bson:"reviewNote,omitempty" json:"reviewNote,omitempty"`
+	Solves      int                 `bson:"solves" json:"solves"`
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
 
 func (c *Challenge) BeforeCreate() {
@@ -64,3 +83,232 @@ func (c *Challenge) BeforeCreate() {
 		c.Solves = 0
 	}
 }
+
+// IsPublished reports whether players can see the challenge
+func (c *Challenge) IsPublished() bool {
+	return c.Status == "" || c.Status == ChallengePublished
+}
+
+// PublishedFilter matches the challenges visible to players
+func PublishedFilter() bson.M {
+	return bson.M{
+		"isActive": true,
+		"status":   bson.M{"$nin": bson.A{ChallengeDraft, ChallengeReview}},
+	}
+}
+
+// ChallengeDifficulties are the values accepted by Challenge.Validate.
+// Categories are managed in the database and checked by the controller.
+var ChallengeDifficulties = []string{"Easy", "Medium", "Hard", "Expert"}
+
+const (
+	maxChallengeTags = 10
+	maxTagLength     = 30
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ChallengeEditableFields maps the JSON keys an admin may change through a
+// patch to their BSON field names. Anything else (id, author, solves,
+// timestamps) is rejected.
+var ChallengeEditableFields = map[string]string{
+	"title":       "title",
+	"description": "description",
+	"category":    "category",
+	"difficulty":  "difficulty",
+	"points":      "points",
+	"flag":        "flag",
+	"hints":       "hints",
+	"tags":        "tags",
+	"mapConfig":   "mapConfig",
+	"files":       "files",
+	"isActive":    "isActive",
+}
+
+// Validate reports the first problem with a challenge before it is saved:
+// a blank title, description or category, a difficulty outside
+// ChallengeDifficulties, negative points or an empty flag.
+func (c *Challenge) Validate() error {
+	if strings.TrimSpace(c.Title) == "" {
+		return errors.New("title is required")
+	}
+	if strings.TrimSpace(c.Description) == "" {
+		return errors.New("description is required")
+	}
+	if strings.TrimSpace(c.Category) == "" {
+		return errors.New("category is required")
+	}
+	if !contains(ChallengeDifficulties, c.Difficulty) {
+		return fmt.Errorf("difficulty must be one of: %s", strings.Join(ChallengeDifficulties, ", "))
+	}
+	if c.Points < 0 {
+		return errors.New("points must not be negative")
+	}
+	if c.Flag == "" {
+		return errors.New("flag is required")
+	}
+	return nil
+}
+
+// ApplyPatch merges a JSON Merge Patch (RFC 7396) into c. Keys outside
+// ChallengeEditableFields are rejected. A null value clears optional fields
+// and is an error for required ones. It returns the $set and $unset
+// documents for the fields that were touched.
+func (c *Challenge) ApplyPatch(patch map[string]json.RawMessage) (bson.M, bson.M, error) {
+	var unknown []string
+	for key := range patch {
+		if _, ok := ChallengeEditableFields[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, nil, fmt.Errorf("fields cannot be updated: %s", strings.Join(unknown, ", "))
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	for key, raw := range patch {
+		field := ChallengeEditableFields[key]
+		isNull := string(raw) == "null"
+
+		var target interface{}
+		switch key {
+		case "title":
+			target = &c.Title
+		case "description":
+			target = &c.Description
+		case "category":
+			target = &c.Category
+		case "difficulty":
+			target = &c.Difficulty
+		case "points":
+			target = &c.Points
+		case "flag":
+			target = &c.Flag
+		case "isActive":
+			target = &c.IsActive
+		case "hints":
+			if isNull {
+				c.Hints = nil
+				unset[field] = ""
+				continue
+			}
+			c.Hints = nil
+			target = &c.Hints
+		case "mapConfig":
+			if isNull {
+				c.MapConfig = nil
+				unset[field] = ""
+				continue
+			}
+			if c.MapConfig == nil {
+				c.MapConfig = &MapConfig{}
+			}
+			target = c.MapConfig
+		case "files":
+			if isNull {
+				c.Files = nil
+				unset[field] = ""
+				continue
+			}
+			c.Files = nil
+			target = &c.Files
+		case "tags":
+			if isNull {
+				c.Tags = nil
+				unset[field] = ""
+				continue
+			}
+			var tags []string
+			if err := json.Unmarshal(raw, &tags); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for %s", key)
+			}
+			normalized, err := NormalizeTags(tags)
+			if err != nil {
+				return nil, nil, err
+			}
+			c.Tags = normalized
+			continue
+		}
+
+		if isNull {
+			return nil, nil, fmt.Errorf("%s cannot be null", key)
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %s", key)
+		}
+	}
+
+	// Take the values from the merged struct so nested merges on mapConfig
+	// are written back in full.
+	for key := range patch {
+		field := ChallengeEditableFields[key]
+		if _, cleared := unset[field]; cleared {
+			continue
+		}
+		switch key {
+		case "title":
+			set[field] = c.Title
+		case "description":
+			set[field] = c.Description
+		case "category":
+			set[field] = c.Category
+		case "difficulty":
+			set[field] = c.Difficulty
+		case "points":
+			set[field] = c.Points
+		case "flag":
+			set[field] = c.Flag
+		case "isActive":
+			set[field] = c.IsActive
+		case "hints":
+			set[field] = c.Hints
+		case "mapConfig":
+			set[field] = c.MapConfig
+		case "files":
+			set[field] = c.Files
+		case "tags":
+			set[field] = c.Tags
+		}
+	}
+
+	return set, unset, nil
+}
+
+// ETag returns an entity tag derived from UpdatedAt, used for If-Match
+// optimistic concurrency on updates.
+func (c *Challenge) ETag() string {
+	return fmt.Sprintf(`"%x"`, c.UpdatedAt.UnixMilli())
+}
+
+// NormalizeTags lowercases and deduplicates free-form tags such as "osint"
+// or "geojson". Tags may contain letters, digits and dashes.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use lowercase letters, digits and dashes", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxChallengeTags {
+		return nil, fmt.Errorf("a challenge can have at most %d tags", maxChallengeTags)
+	}
+	return normalized, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision actions
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRollback = "rollback"
+)
+
+// FieldChange is one entry of a revision diff
+type FieldChange struct {
+	From interface{} `bson:"from" json:"from"`
+	To   interface{} `bson:"to" json:"to"`
+}
+
+// ChallengeRevision is an immutable record of a change to a challenge. The
+// snapshot holds the full challenge after the change (including the flag),
+// so any revision can be rolled back to.
+type ChallengeRevision struct {
+	ID             primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	ChallengeID    primitive.ObjectID     `bson:"challenge" json:"challengeId"`
+	Action         string                 `bson:"action" json:"action"`
+	AuthorID       primitive.ObjectID     `bson:"author" json:"authorId"`
+	Diff           map[string]FieldChange `bson:"diff" json:"diff"`
+	Snapshot       Challenge              `bson:"snapshot" json:"snapshot"`
+	RolledBackFrom *primitive.ObjectID    `bson:"rolledBackFrom,omitempty" json:"rolledBackFrom,omitempty"`
+	CreatedAt      time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+func (r *ChallengeRevision) BeforeCreate() {
+	r.CreatedAt = time.Now()
+}
+
+// DiffChallenges compares the editable fields of two challenges. The flag
+// value itself is never written to the diff, only the fact that it changed.
+func DiffChallenges(before, after *Challenge) map[string]FieldChange {
+	from := challengeFields(before)
+	to := challengeFields(after)
+
+	diff := map[string]FieldChange{}
+	for _, field := range ChallengeEditableFields {
+		if reflect.DeepEqual(from[field], to[field]) {
+			continue
+		}
+		change := FieldChange{From: from[field], To: to[field]}
+		if field == "flag" {
+			change = FieldChange{From: "********", To: "********"}
+		}
+		diff[field] = change
+	}
+	return diff
+}
+
+func challengeFields(c *Challenge) bson.M {
+	fields := bson.M{}
+	if c == nil {
+		return fields
+	}
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return fields
+	}
+	_ = bson.Unmarshal(raw, &fields)
+	return fields
+}
+
+// Clone returns a deep copy of the challenge
+func (c *Challenge) Clone() Challenge {
+	var clone Challenge
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return *c
+	}
+	if err := bson.Unmarshal(raw, &clone); err != nil {
+		return *c
+	}
+	return clone
+}
+
+// EditableUpdate returns the $set and $unset documents that write the
+// editable fields of c back to the database.
+func (c *Challenge) EditableUpdate() (bson.M, bson.M) {
+	fields := challengeFields(c)
+	set := bson.M{}
+	unset := bson.M{}
+	for _, field := range ChallengeEditableFields {
+		if value, ok := fields[field]; ok {
+			set[field] = value
+		} else {
+			unset[field] = ""
+		}
+	}
+	return set, unset
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestChallengeApplyPatch(t *testing.T) {
+	challenge := Challenge{
+		Title:       "GPS Spoofing",
+		Description: "Find the hidden location",
+		Category:    "GIS",
+		Difficulty:  "Easy",
+		Points:      100,
+		Flag:        "CTF{old}",
+		Hints:       []Hint{{Text: "look at the map"}},
+		Solves:      7,
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"points": 150, "flag": "CTF{new}", "hints": null}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	set, unset, err := challenge.ApplyPatch(patch)
+	if err != nil {
+		t.Fatalf("ApplyPatch: %v", err)
+	}
+	if challenge.Points != 150 || challenge.Flag != "CTF{new}" || challenge.Hints != nil {
+		t.Fatalf("patch not merged: %+v", challenge)
+	}
+	if set["points"] != 150 || set["flag"] != "CTF{new}" {
+		t.Fatalf("unexpected $set: %v", set)
+	}
+	if _, ok := unset["hints"]; !ok {
+		t.Fatalf("expected hints in $unset, got %v", unset)
+	}
+	if err := challenge.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestChallengeApplyPatchRejectsProtectedFields(t *testing.T) {
+	for _, body := range []string{`{"solves": 0}`, `{"author": "x"}`, `{"_id": "x"}`, `{"titel": "typo"}`} {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &patch); err != nil {
+			t.Fatal(err)
+		}
+		var challenge Challenge
+		if _, _, err := challenge.ApplyPatch(patch); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestChallengeApplyPatchRejectsNullRequired(t *testing.T) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"title": null}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+	var challenge Challenge
+	if _, _, err := challenge.ApplyPatch(patch); err == nil {
+		t.Error("expected null title to be rejected")
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const MaxFeedbackCommentLength = 500
+
+// Feedback is a player's rating of a challenge. There is at most one per
+// user and challenge; submitting again replaces it.
+type Feedback struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ChallengeID primitive.ObjectID `bson:"challenge" json:"challengeId" validate:"required"`
+	UserID      primitive.ObjectID `bson:"user" json:"userId" validate:"required"`
+	Difficulty  int                `bson:"difficulty" json:"difficulty" validate:"required,min=1,max=5"`
+	Quality     int                `bson:"quality" json:"quality" validate:"required,min=1,max=5"`
+	Comment     string             `bson:"comment,omitempty" json:"comment,omitempty" validate:"max=500"`
+	Solved      bool               `bson:"solved" json:"solved"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (f *Feedback) BeforeCreate() {
+	timeNow := time.Now()
+	f.CreatedAt = timeNow
+	f.UpdatedAt = timeNow
+}
+
+// Validate requires both ratings to be 1 to 5 and trims the comment, which
+// may be at most MaxFeedbackCommentLength characters
+func (f *Feedback) Validate() error {
+	if f.Difficulty < 1 || f.Difficulty > 5 {
+		return errors.New("difficulty must be between 1 and 5")
+	}
+	if f.Quality < 1 || f.Quality > 5 {
+		return errors.New("quality must be between 1 and 5")
+	}
+	f.Comment = strings.TrimSpace(f.Comment)
+	if len([]rune(f.Comment)) > MaxFeedbackCommentLength {
+		return errors.New("comment must be at most 500 characters")
+	}
+	return nil
+}
+
+// FeedbackSummary aggregates the feedback of one challenge
+type FeedbackSummary struct {
+	Count               int     `bson:"count" json:"count"`
+	AverageDifficulty   float64 `bson:"averageDifficulty" json:"averageDifficulty"`
+	AverageQuality      float64 `bson:"averageQuality" json:"averageQuality"`
+	SolverCount         int     `bson:"solverCount" json:"solverCount"`
+	SuggestedDifficulty string  `bson:"-" json:"suggestedDifficulty,omitempty"`
+}
+
+// SuggestDifficulty maps an average 1-5 difficulty rating onto the
+// Challenge.Difficulty scale.
+func SuggestDifficulty(average float64) string {
+	switch {
+	case average <= 0:
+		return ""
+	case average < 2:
+		return "Easy"
+	case average < 3:
+		return "Medium"
+	case average < 4:
+		return "Hard"
+	default:
+		return "Expert"
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OIDCLogin is an OpenID Connect login in progress, keyed by its state
+// parameter. It keeps the nonce and PKCE verifier on the server until the
+// callback, and is deleted when used.
+type OIDCLogin struct {
+	State     string    `bson:"_id"`
+	Nonce     string    `bson:"nonce"`
+	Verifier  string    `bson:"verifier"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func (l *OIDCLogin) BeforeCreate(ttl time.Duration) {
+	l.CreatedAt = time.Now()
+	l.ExpiresAt = l.CreatedAt.Add(ttl)
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset is an emailed password reset. Only the hash of the token is
+// stored, and it can be used once before ExpiresAt.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user" json:"userId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+}
+
+func (r *PasswordReset) BeforeCreate(ttl time.Duration) {
+	r.CreatedAt = time.Now()
+	r.ExpiresAt = r.CreatedAt.Add(ttl)
+}
@@ -15,3 +15,47 @@ type Scoreboard struct {
 	Rank      int                `bson:"rank,omitempty" json:"rank,omitempty"`
 	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
+
+// ScoreboardEntry is one ranked row of a computed scoreboard, for a user or
+// a team.
+type ScoreboardEntry struct {
+	Rank      int                 `json:"rank"`
+	ID        primitive.ObjectID  `json:"id"`
+	Name      string              `json:"name"`
+	BracketID *primitive.ObjectID `json:"bracketId,omitempty"`
+	Score     int                 `json:"score"`
+	Solves    int                 `json:"solves"`
+	LastSolve *time.Time          `json:"lastSolve,omitempty"`
+}
+
+// ProfileSolve is a solve as listed on a team or user profile
+type ProfileSolve struct {
+	ChallengeID primitive.ObjectID `json:"challengeId"`
+	Title       string             `json:"title"`
+	Category    string             `json:"category"`
+	Points      int                `json:"points"`
+	SolvedBy    primitive.ObjectID `json:"solvedBy"`
+	Username    string             `json:"username"`
+	SolvedAt    time.Time          `json:"solvedAt"`
+}
+
+// MemberContribution is a team member's share of the team's solves
+type MemberContribution struct {
+	ID       primitive.ObjectID `json:"id"`
+	Username string             `json:"username"`
+	Solves   int                `json:"solves"`
+	Points   int                `json:"points"`
+}
+
+// Profile is the computed profile of a team or user. Members is only set
+// for teams.
+type Profile struct {
+	ID               primitive.ObjectID   `json:"id"`
+	Name             string               `json:"name"`
+	Rank             int                  `json:"rank,omitempty"`
+	Score            int                  `json:"score"`
+	Frozen           bool                 `json:"frozen"`
+	Members          []MemberContribution `json:"members,omitempty"`
+	Solves           []ProfileSolve       `json:"solves"`
+	PointsByCategory map[string]int       `json:"pointsByCategory"`
+}
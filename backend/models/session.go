@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a login on one device. It holds the hash of the current
+// refresh token, which rotates on every refresh, and the ID of the last
+// access token issued so revoking the session can deny it too.
+type Session struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID            primitive.ObjectID `bson:"user" json:"userId"`
+	TokenHash         string             `bson:"tokenHash" json:"-"`
+	PreviousTokenHash string             `bson:"previousTokenHash,omitempty" json:"-"`
+	AccessTokenID     string             `bson:"accessTokenId" json:"-"`
+	AccessExpiresAt   time.Time          `bson:"accessExpiresAt" json:"-"`
+	UserAgent         string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	IP                string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt        time.Time          `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt         time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt         *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func (s *Session) BeforeCreate(ttl time.Duration) {
+	s.CreatedAt = time.Now()
+	s.LastUsedAt = s.CreatedAt
+	s.ExpiresAt = s.CreatedAt.Add(ttl)
+}
+
+// Active reports whether the session can still be refreshed
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RevokedToken is a denylisted access token, kept until it would have
+// expired anyway.
+type RevokedToken struct {
+	ID        string    `bson:"_id" json:"id"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
@@ -7,15 +7,38 @@ import (
 )
 
 type Submission struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	UserID        primitive.ObjectID `bson:"user" json:"userId" validate:"required"`
-	ChallengeID   primitive.ObjectID `bson:"challenge" json:"challengeId" validate:"required"`
-	Flag          string             `bson:"flag" json:"flag" validate:"required"`
-	IsCorrect     bool               `bson:"isCorrect" json:"isCorrect"`
-	PointsAwarded int                `bson:"pointsAwarded" json:"pointsAwarded"`
-	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID        primitive.ObjectID  `bson:"user" json:"userId" validate:"required"`
+	ChallengeID   primitive.ObjectID  `bson:"challenge" json:"challengeId" validate:"required"`
+	TeamID        *primitive.ObjectID `bson:"team,omitempty" json:"teamId,omitempty"`
+	Flag          string              `bson:"flag" json:"flag" validate:"required"`
+	IsCorrect     bool                `bson:"isCorrect" json:"isCorrect"`
+	PointsAwarded int                 `bson:"pointsAwarded" json:"pointsAwarded"`
+	TeamCredit    bool                `bson:"teamCredit,omitempty" json:"-"`
+	CreatedAt     time.Time           `bson:"createdAt" json:"createdAt"`
 }
 
 func (s *Submission) BeforeCreate() {
 	s.CreatedAt = time.Now()
 }
+
+// Solve is one entry of a challenge's solver list. UserID and Username are
+// set for user solves, TeamID and TeamName for team solves.
+type Solve struct {
+	Rank     int                 `json:"rank"`
+	UserID   *primitive.ObjectID `json:"userId,omitempty"`
+	Username string              `json:"username,omitempty"`
+	TeamID   *primitive.ObjectID `json:"teamId,omitempty"`
+	TeamName string              `json:"teamName,omitempty"`
+	SolvedAt time.Time           `json:"solvedAt"`
+}
+
+// SolveStats summarises the attempts on one challenge (admin view)
+type SolveStats struct {
+	Attempts               int64    `json:"attempts"`
+	Attempters             int      `json:"attempters"`
+	Solvers                int      `json:"solvers"`
+	SolveRate              float64  `json:"solveRate"`
+	MedianTimeToSolve      *float64 `json:"medianTimeToSolveSeconds,omitempty"`
+	AttemptsBeforeSolveAvg *float64 `json:"averageAttemptsBeforeSolve,omitempty"`
+}
@@ -12,7 +12,8 @@ type Team struct {
 	Members   []primitive.ObjectID `bson:"members" json:"members"`
 	Score     int                  `bson:"score" json:"score"`
 	CaptainID primitive.ObjectID   `bson:"captain" json:"captainId" validate:"required"`
-	Token     string               `bson:"token,omitempty" json:"token,omitempty"`
+	Token     string               `bson:"token,omitempty" json:"-"`
+	Bracket   *BracketMembership   `bson:"bracket,omitempty" json:"bracket,omitempty"`
 	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time            `bson:"updatedAt" json:"updatedAt"`
 }
@@ -25,3 +26,59 @@ func (t *Team) BeforeCreate() {
 		t.Score = 0
 	}
 }
+
+// TeamMember is a team member as listed in team views
+type TeamMember struct {
+	ID       primitive.ObjectID `json:"id"`
+	Username string             `json:"username"`
+}
+
+// PublicTeam is the view of a team anyone can see
+type PublicTeam struct {
+	ID        primitive.ObjectID `json:"id"`
+	Name      string             `json:"name"`
+	Score     int                `json:"score"`
+	Members   []TeamMember       `json:"members"`
+	Bracket   *BracketMembership `json:"bracket,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+// MemberTeam is the view of a team for its own members
+type MemberTeam struct {
+	PublicTeam
+	CaptainID  primitive.ObjectID `json:"captainId"`
+	InviteCode string             `json:"inviteCode"`
+}
+
+// CaptainTeam is the view of a team for its captain and admins
+type CaptainTeam struct {
+	MemberTeam
+	MaxSize   int       `json:"maxSize,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Public builds the public view. usernames maps member IDs to usernames.
+func (t *Team) Public(usernames map[primitive.ObjectID]string) PublicTeam {
+	members := make([]TeamMember, 0, len(t.Members))
+	for _, id := range t.Members {
+		members = append(members, TeamMember{ID: id, Username: usernames[id]})
+	}
+	return PublicTeam{
+		ID:        t.ID,
+		Name:      t.Name,
+		Score:     t.Score,
+		Members:   members,
+		Bracket:   t.Bracket,
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+// HasMember reports whether userID is in the team
+func (t *Team) HasMember(userID primitive.ObjectID) bool {
+	for _, member := range t.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
+}
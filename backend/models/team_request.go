@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Team join request states
+const (
+	TeamRequestPending   = "pending"
+	TeamRequestAccepted  = "accepted"
+	TeamRequestDeclined  = "declined"
+	TeamRequestCancelled = "cancelled"
+	TeamRequestExpired   = "expired"
+)
+
+// TeamRequest is a player's request to join a team, decided by its captain.
+// A pending request past ExpiresAt counts as expired.
+type TeamRequest struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	TeamID    primitive.ObjectID  `bson:"team" json:"teamId" validate:"required"`
+	UserID    primitive.ObjectID  `bson:"user" json:"userId" validate:"required"`
+	Username  string              `bson:"username" json:"username"`
+	Message   string              `bson:"message,omitempty" json:"message,omitempty" validate:"max=300"`
+	Status    string              `bson:"status" json:"status"`
+	DecidedBy *primitive.ObjectID `bson:"decidedBy,omitempty" json:"decidedBy,omitempty"`
+	DecidedAt *time.Time          `bson:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time           `bson:"expiresAt" json:"expiresAt"`
+}
+
+func (r *TeamRequest) BeforeCreate(ttl time.Duration) {
+	r.CreatedAt = time.Now()
+	r.ExpiresAt = r.CreatedAt.Add(ttl)
+	r.Status = TeamRequestPending
+}
+
+// EffectiveStatus reports expired for pending requests past their expiry
+func (r *TeamRequest) EffectiveStatus() string {
+	if r.Status == TeamRequestPending && time.Now().After(r.ExpiresAt) {
+		return TeamRequestExpired
+	}
+	return r.Status
+}
@@ -1,8 +1,17 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -12,25 +21,201 @@ type SolvedChallenge struct {
 	Points      int                `bson:"points" json:"points"`
 }
 
+// User roles
+const (
+	RoleUser   = "user"
+	RoleAuthor = "author"
+	RoleAdmin  = "admin"
+)
+
 type User struct {
-	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Username         string             `bson:"username" json:"username" validate:"required,min=3,max=30"`
-	Email            string             `bson:"email" json:"email" validate:"required,email"`
-	Password         string             `bson:"password" json:"-" validate:"required,min=8"`
-	Role             string             `bson:"role" json:"role" validate:"oneof=user admin"`
-	Score            int                `bson:"score" json:"score"`
-	SolvedChallenges []SolvedChallenge  `bson:"solvedChallenges" json:"solvedChallenges"`
-	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
-	LastActive       time.Time          `bson:"lastActive" json:"lastActive"`
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Username          string              `bson:"username" json:"username" validate:"required,min=3,max=30"`
+	DisplayName       string              `bson:"displayName,omitempty" json:"displayName,omitempty" validate:"max=50"`
+	Affiliation       string              `bson:"affiliation,omitempty" json:"affiliation,omitempty" validate:"max=100"`
+	Country           string              `bson:"country,omitempty" json:"country,omitempty" validate:"omitempty,iso3166_1_alpha2"`
+	Website           string              `bson:"website,omitempty" json:"website,omitempty" validate:"omitempty,url,max=200"`
+	Bio               string              `bson:"bio,omitempty" json:"bio,omitempty" validate:"max=500"`
+	Email             string              `bson:"email" json:"email" validate:"required,email"`
+	EmailVerified     bool                `bson:"emailVerified" json:"emailVerified"`
+	Password          string              `bson:"password" json:"-" validate:"required,min=8"`
+	Role              string              `bson:"role" json:"role" validate:"oneof=user author admin"`
+	Score             int                 `bson:"score" json:"score"`
+	SolvedChallenges  []SolvedChallenge   `bson:"solvedChallenges" json:"solvedChallenges"`
+	TeamID            *primitive.ObjectID `bson:"team,omitempty" json:"teamId,omitempty"`
+	Bracket           *BracketMembership  `bson:"bracket,omitempty" json:"bracket,omitempty"`
+	Hidden            bool                `bson:"hidden,omitempty" json:"hidden,omitempty"`
+	Ban               *UserBan            `bson:"ban,omitempty" json:"ban,omitempty"`
+	TwoFactor         *TwoFactor          `bson:"twoFactor,omitempty" json:"-"`
+	OIDC              *OIDCLink           `bson:"oidc,omitempty" json:"oidc,omitempty"`
+	UsernameChangedAt *time.Time          `bson:"usernameChangedAt,omitempty" json:"usernameChangedAt,omitempty"`
+	CreatedAt         time.Time           `bson:"createdAt" json:"createdAt"`
+	LastActive        time.Time           `bson:"lastActive" json:"lastActive"`
 }
 
 func (u *User) BeforeCreate() {
 	u.CreatedAt = time.Now()
 	u.LastActive = time.Now()
 	if u.Role == "" {
-		u.Role = "user"
+		u.Role = RoleUser
 	}
 	if u.Score == 0 {
 		u.Score = 0
 	}
 }
+
+// UserBan records why and until when a user is banned. A nil Until is a
+// permanent ban.
+type UserBan struct {
+	Reason   string             `bson:"reason" json:"reason"`
+	Until    *time.Time         `bson:"until,omitempty" json:"until,omitempty"`
+	BannedBy primitive.ObjectID `bson:"bannedBy" json:"bannedBy"`
+	BannedAt time.Time          `bson:"bannedAt" json:"bannedAt"`
+}
+
+// Active reports whether the ban is still in force
+func (b *UserBan) Active() bool {
+	return b != nil && (b.Until == nil || time.Now().Before(*b.Until))
+}
+
+// TwoFactor holds a user's TOTP enrolment. The secret is pending until the
+// first code is confirmed. Recovery codes are stored hashed and each works
+// once.
+type TwoFactor struct {
+	Secret        string     `bson:"secret"`
+	Enabled       bool       `bson:"enabled"`
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty"`
+	LastStep      int64      `bson:"lastStep"`
+	RecoveryCodes []string   `bson:"recoveryCodes,omitempty"`
+	Failures      int        `bson:"failedAttempts,omitempty"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty"`
+}
+
+// OIDCLink ties a user to an account at an OpenID Connect issuer
+type OIDCLink struct {
+	Issuer   string    `bson:"issuer" json:"issuer"`
+	Subject  string    `bson:"subject" json:"subject"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// TwoFactorEnabled reports whether the user logs in with a TOTP code
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// PublicUser is the view of a user anyone can see
+type PublicUser struct {
+	ID          primitive.ObjectID  `json:"id"`
+	Username    string              `json:"username"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Affiliation string              `json:"affiliation,omitempty"`
+	Country     string              `json:"country,omitempty"`
+	Website     string              `json:"website,omitempty"`
+	Bio         string              `json:"bio,omitempty"`
+	Score       int                 `json:"score"`
+	TeamID      *primitive.ObjectID `json:"teamId,omitempty"`
+	Bracket     *BracketMembership  `json:"bracket,omitempty"`
+	CreatedAt   time.Time           `json:"createdAt"`
+}
+
+// Public builds the public view of the user
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Affiliation: u.Affiliation,
+		Country:     u.Country,
+		Website:     u.Website,
+		Bio:         u.Bio,
+		Score:       u.Score,
+		TeamID:      u.TeamID,
+		Bracket:     u.Bracket,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+// UserProfileFields maps the JSON keys a user may change through a profile
+// update to their BSON field names. Email, username and password have their
+// own endpoints; anything else is rejected.
+var UserProfileFields = map[string]string{
+	"displayName": "displayName",
+	"affiliation": "affiliation",
+	"country":     "country",
+	"website":     "website",
+	"bio":         "bio",
+}
+
+// profileFieldLimits are the maximum lengths of profile fields, in
+// characters
+var profileFieldLimits = map[string]int{
+	"displayName": 50,
+	"affiliation": 100,
+	"country":     2,
+	"website":     200,
+	"bio":         500,
+}
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ApplyProfilePatch merges a profile update into u. Keys outside
+// UserProfileFields are rejected. A null or empty value clears the field.
+// It returns the $set and $unset documents for the fields that were touched.
+func (u *User) ApplyProfilePatch(patch map[string]json.RawMessage) (bson.M, bson.M, error) {
+	var unknown []string
+	for key := range patch {
+		if _, ok := UserProfileFields[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, nil, fmt.Errorf("fields cannot be updated: %s", strings.Join(unknown, ", "))
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	for key, raw := range patch {
+		var value string
+		if string(raw) != "null" {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for %s", key)
+			}
+		}
+		value = strings.TrimSpace(value)
+		if utf8.RuneCountInString(value) > profileFieldLimits[key] {
+			return nil, nil, fmt.Errorf("%s must be at most %d characters", key, profileFieldLimits[key])
+		}
+
+		switch key {
+		case "displayName":
+			u.DisplayName = value
+		case "affiliation":
+			u.Affiliation = value
+		case "country":
+			value = strings.ToUpper(value)
+			if value != "" && !countryPattern.MatchString(value) {
+				return nil, nil, errors.New("country must be a two-letter ISO 3166 code")
+			}
+			u.Country = value
+		case "website":
+			if value != "" {
+				link, err := url.Parse(value)
+				if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+					return nil, nil, errors.New("website must be an http or https URL")
+				}
+			}
+			u.Website = value
+		case "bio":
+			u.Bio = value
+		}
+
+		if value == "" {
+			unset[UserProfileFields[key]] = ""
+		} else {
+			set[UserProfileFields[key]] = value
+		}
+	}
+
+	return set, unset, nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserApplyProfilePatch(t *testing.T) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"displayName": " Alice ", "country": "de", "website": "https://alice.example", "bio": null}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	user := User{Bio: "old bio"}
+	set, unset, err := user.ApplyProfilePatch(patch)
+	if err != nil {
+		t.Fatalf("ApplyProfilePatch: %v", err)
+	}
+	if user.DisplayName != "Alice" || user.Country != "DE" || user.Bio != "" {
+		t.Fatalf("patch not merged: %+v", user)
+	}
+	if set["displayName"] != "Alice" || set["country"] != "DE" || set["website"] != "https://alice.example" {
+		t.Fatalf("unexpected $set: %v", set)
+	}
+	if _, ok := unset["bio"]; !ok {
+		t.Fatalf("expected bio in $unset, got %v", unset)
+	}
+}
+
+func TestUserApplyProfilePatchRejects(t *testing.T) {
+	for _, body := range []string{
+		`{"score": 9000}`,
+		`{"email": "x@example.com"}`,
+		`{"username": "admin"}`,
+		`{"password": "hunter22"}`,
+		`{"solvedChallenges": []}`,
+		`{"country": "Germany"}`,
+		`{"website": "javascript:alert(1)"}`,
+		`{"displayName": 42}`,
+	} {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &patch); err != nil {
+			t.Fatal(err)
+		}
+		var user User
+		if _, _, err := user.ApplyProfilePatch(patch); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
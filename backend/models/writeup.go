@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Writeup moderation states
+const (
+	WriteupPending  = "pending"
+	WriteupApproved = "approved"
+	WriteupRejected = "rejected"
+)
+
+const MaxWriteupLength = 100000
+
+// Writeup is a player's solution for a challenge they solved. Content is
+// Markdown, sanitized before it is stored.
+type Writeup struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	ChallengeID    primitive.ObjectID  `bson:"challenge" json:"challengeId" validate:"required"`
+	UserID         primitive.ObjectID  `bson:"user" json:"userId" validate:"required"`
+	Content        string              `bson:"content" json:"content" validate:"required,max=100000"`
+	Status         string              `bson:"status" json:"status" validate:"oneof=pending approved rejected"`
+	ModeratorID    *primitive.ObjectID `bson:"moderator,omitempty" json:"moderatorId,omitempty"`
+	ModerationNote string              `bson:"moderationNote,omitempty" json:"moderationNote,omitempty"`
+	BonusPoints    int                 `bson:"bonusPoints" json:"bonusPoints"`
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (w *Writeup) BeforeCreate() {
+	timeNow := time.Now()
+	w.CreatedAt = timeNow
+	w.UpdatedAt = timeNow
+	if w.Status == "" {
+		w.Status = WriteupPending
+	}
+}
@@ -0,0 +1,299 @@
+// Package oidc implements OpenID Connect login with the authorization code
+// flow and PKCE.
+//
+// It is configured from the environment:
+//
+//	OIDC_ISSUER                  issuer URL, discovery is read from it
+//	OIDC_CLIENT_ID               client registered with the issuer
+//	OIDC_CLIENT_SECRET           optional, omitted for public clients
+//	OIDC_REDIRECT_URL            where the issuer sends the user back
+//	OIDC_SCOPES                  defaults to "openid email profile"
+//	OIDC_USERNAME_CLAIM          defaults to "preferred_username"
+//	OIDC_EMAIL_CLAIM             defaults to "email"
+//	OIDC_EMAIL_VERIFIED_CLAIM    defaults to "email_verified"
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Config describes the client and how claims map onto users
+type Config struct {
+	Issuer             string
+	ClientID           string
+	ClientSecret       string
+	RedirectURL        string
+	Scopes             []string
+	UsernameClaim      string
+	EmailClaim         string
+	EmailVerifiedClaim string
+}
+
+// ConfigFromEnv reads the configuration. The second value is false when
+// OIDC is not configured.
+func ConfigFromEnv() (Config, bool) {
+	cfg := Config{
+		Issuer:             strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:           os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:       os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:        os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:             strings.Fields(envOr("OIDC_SCOPES", "openid email profile")),
+		UsernameClaim:      envOr("OIDC_USERNAME_CLAIM", "preferred_username"),
+		EmailClaim:         envOr("OIDC_EMAIL_CLAIM", "email"),
+		EmailVerifiedClaim: envOr("OIDC_EMAIL_VERIFIED_CLAIM", "email_verified"),
+	}
+	return cfg, cfg.Issuer != "" && cfg.ClientID != "" && cfg.RedirectURL != ""
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Identity is the verified result of a login
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider talks to one issuer
+type Provider struct {
+	config Config
+	client *http.Client
+
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+// NewProvider reads the issuer's discovery document
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, client, cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", discovery.Issuer, cfg.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+
+	return &Provider{
+		config:        cfg,
+		client:        client,
+		authEndpoint:  discovery.AuthorizationEndpoint,
+		tokenEndpoint: discovery.TokenEndpoint,
+		jwksURI:       discovery.JWKSURI,
+	}, nil
+}
+
+// AuthURL returns the URL to send the user to
+func (p *Provider) AuthURL(state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + v.Encode()
+}
+
+// Exchange redeems an authorization code and verifies the ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("oidc token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("oidc token: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	return p.verify(ctx, token.IDToken, nonce)
+}
+
+// verify checks the ID token signature, issuer, audience, expiry and nonce,
+// and maps its claims
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Identity, error) {
+	parsed, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("oidc id token: invalid claims")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != p.config.Issuer {
+		return nil, errors.New("oidc id token: wrong issuer")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("oidc id token: wrong audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("oidc id token: missing expiry")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+
+	identity := &Identity{Issuer: p.config.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Username, _ = claims[p.config.UsernameClaim].(string)
+	identity.Email, _ = claims[p.config.EmailClaim].(string)
+	switch verified := claims[p.config.EmailVerifiedClaim].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("oidc id token: missing subject")
+	}
+	return identity, nil
+}
+
+// key returns the issuer's key with kid, fetching the key set again when
+// the kid is unknown so issuer key rotation is picked up.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set jwkSet
+	if err := getJSON(ctx, p.client, p.jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	p.keys = set.publicKeys()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Issuers with a single key may leave kid out
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("oidc jwks: unknown key id %q", kid)
+}
+
+// NewVerifier returns a random PKCE code verifier
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// Challenge returns the S256 PKCE challenge for a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random value for the state or nonce parameter
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
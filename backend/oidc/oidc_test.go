@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ctf-backend/oidc/oidctest"
+)
+
+func newMockIssuer(t *testing.T) (*oidctest.Issuer, Config) {
+	t.Helper()
+
+	var issuer *oidctest.Issuer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	issuer, err := oidctest.New(server.URL, "ctf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.Claims = map[string]interface{}{
+		"sub":                "u-42",
+		"preferred_username": "alice",
+		"email":              "alice@uni.example",
+		"email_verified":     true,
+	}
+
+	return issuer, Config{
+		Issuer:             server.URL,
+		ClientID:           "ctf",
+		RedirectURL:        "http://localhost:3000/oidc/callback",
+		Scopes:             []string{"openid", "email", "profile"},
+		UsernameClaim:      "preferred_username",
+		EmailClaim:         "email",
+		EmailVerifiedClaim: "email_verified",
+	}
+}
+
+// authorize follows the auth URL and returns the code from the redirect
+func authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query()
+}
+
+func TestLoginAgainstMockIssuer(t *testing.T) {
+	_, cfg := newMockIssuer(t)
+	ctx := context.Background()
+
+	provider, err := NewProvider(ctx, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, _ := NewVerifier()
+	state, _ := NewState()
+	nonce, _ := NewState()
+	callback := authorize(t, provider.AuthURL(state, nonce, verifier))
+	if callback.Get("state") != state {
+		t.Fatalf("state = %q, want %q", callback.Get("state"), state)
+	}
+
+	identity, err := provider.Exchange(ctx, callback.Get("code"), verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "u-42" || identity.Username != "alice" || identity.Email != "alice@uni.example" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// Codes are single use
+	if _, err := provider.Exchange(ctx, callback.Get("code"), verifier, nonce); err == nil {
+		t.Error("code was redeemed twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	_, cfg := newMockIssuer(t)
+	ctx := context.Background()
+
+	provider, err := NewProvider(ctx, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, _ := NewVerifier()
+	other, _ := NewVerifier()
+	callback := authorize(t, provider.AuthURL("s", "n", verifier))
+	if _, err := provider.Exchange(ctx, callback.Get("code"), other, "n"); err == nil {
+		t.Error("exchange with the wrong PKCE verifier succeeded")
+	}
+
+	callback = authorize(t, provider.AuthURL("s", "n", verifier))
+	if _, err := provider.Exchange(ctx, callback.Get("code"), verifier, "other"); err == nil {
+		t.Error("exchange with the wrong nonce succeeded")
+	}
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"ctf-backend/controllers"
+	"ctf-backend/database"
+	"ctf-backend/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAdminRoutes(api fiber.Router) {
+	// Use global database instance
+	adminUserController := controllers.NewAdminUserController(database.DB)
+
+	adminRoutes := api.Group("/admin", middleware.RequireAuth(), middleware.RequireAdmin())
+	{
+		adminRoutes.Get("/users", adminUserController.GetUsers)
+		adminRoutes.Get("/users/:id", adminUserController.GetUser)
+		adminRoutes.Put("/users/:id/role", adminUserController.SetRole)
+		adminRoutes.Post("/users/:id/ban", adminUserController.Ban)
+		adminRoutes.Delete("/users/:id/ban", adminUserController.Unban)
+		adminRoutes.Put("/users/:id/hidden", adminUserController.SetHidden)
+		adminRoutes.Post("/users/:id/password-reset", adminUserController.SendPasswordReset)
+		adminRoutes.Post("/users/:id/score-reset", adminUserController.ResetScore)
+		adminRoutes.Delete("/users/:id", adminUserController.DeleteUser)
+
+		adminRoutes.Get("/audit", adminUserController.GetAuditLog)
+	}
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"ctf-backend/controllers"
+	"ctf-backend/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupAuthRoutes(api fiber.Router) {
+	oidcController := controllers.NewOIDCController(database.DB)
+
+	authRoutes := api.Group("/auth")
+	{
+		// OpenID Connect login, the frontend posts the issuer's code back
+		authRoutes.Get("/oidc/start", oidcController.Start)
+		authRoutes.Post("/oidc/callback", oidcController.Callback)
+	}
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"ctf-backend/controllers"
+	"ctf-backend/database"
+	"ctf-backend/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupCategoryRoutes(api fiber.Router) {
+	// Use global database instance
+	categoryController := controllers.NewCategoryController(database.DB)
+
+	categoryRoutes := api.Group("/categories")
+	{
+		// Public routes
+		categoryRoutes.Get("/", categoryController.GetAllCategories)
+
+		// Protected routes (require admin)
+		categoryRoutes.Use(middleware.RequireAuth(), middleware.RequireAdmin())
+		categoryRoutes.Post("/", categoryController.CreateCategory)
+		categoryRoutes.Put("/:id", categoryController.UpdateCategory)
+		categoryRoutes.Delete("/:id", categoryController.DeleteCategory)
+	}
+}
@@ -11,17 +11,34 @@ import (
 func SetupChallengeRoutes(api fiber.Router) {
 	// Use global database instance
 	challengeController := controllers.NewChallengeController(database.DB)
+	feedbackController := controllers.NewFeedbackController(database.DB)
 
 	challengeRoutes := api.Group("/challenges")
 	{
 		// Public routes
-		challengeRoutes.Get("/", challengeController.GetAllChallenges)
-		challengeRoutes.Get("/:id", challengeController.GetChallengeByID)
+		challengeRoutes.Get("/", middleware.OptionalAuth(), challengeController.GetAllChallenges)
+		challengeRoutes.Get("/authored", middleware.RequireAuth(), middleware.RequireAuthor(), challengeController.GetAuthoredChallenges)
+		challengeRoutes.Get("/:id", middleware.OptionalAuth(), challengeController.GetChallengeByID)
+		challengeRoutes.Get("/:id/solves", middleware.OptionalAuth(), challengeController.GetChallengeSolves)
+		challengeRoutes.Get("/:id/solves/stats", middleware.RequireAuth(), middleware.RequireAdmin(), challengeController.GetChallengeSolveStats)
 
-		// Protected routes (require admin)
-		challengeRoutes.Use(middleware.RequireAuth(), middleware.RequireAdmin())
+		// Player feedback
+		challengeRoutes.Post("/:id/feedback", middleware.RequireAuth(), feedbackController.SubmitFeedback)
+		challengeRoutes.Get("/:id/feedback", middleware.RequireAuth(), middleware.RequireAuthor(), feedbackController.GetChallengeFeedback)
+
+		// Protected routes (require author or admin)
+		challengeRoutes.Use(middleware.RequireAuth(), middleware.RequireAuthor())
 		challengeRoutes.Post("/", challengeController.CreateChallenge)
 		challengeRoutes.Put("/:id", challengeController.UpdateChallenge)
-		challengeRoutes.Delete("/:id", challengeController.DeleteChallenge)
+		challengeRoutes.Patch("/:id", challengeController.UpdateChallenge)
+		challengeRoutes.Post("/:id/submit", challengeController.SubmitChallengeForReview)
+		challengeRoutes.Post("/:id/approve", challengeController.ApproveChallenge)
+		challengeRoutes.Post("/:id/reject", challengeController.RejectChallenge)
+		challengeRoutes.Post("/:id/test-solve", challengeController.TestSolveChallenge)
+
+		// Admin only
+		challengeRoutes.Delete("/:id", middleware.RequireAdmin(), challengeController.DeleteChallenge)
+		challengeRoutes.Get("/:id/revisions", middleware.RequireAdmin(), challengeController.GetChallengeRevisions)
+		challengeRoutes.Post("/:id/revisions/:revisionId/rollback", middleware.RequireAdmin(), challengeController.RollbackChallenge)
 	}
 }
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"ctf-backend/auth"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -10,12 +12,22 @@ func SetupRoutes(app *fiber.App) {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
+	// Public keys for services that verify our tokens
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		return c.JSON(auth.JWKS())
+	})
+
 	// Initialize API v1 routes
 	api := app.Group("/api/v1")
 
 	// Setup routes for each domain
 	SetupUserRoutes(api)
+	SetupAuthRoutes(api)
 	SetupChallengeRoutes(api)
+	SetupCategoryRoutes(api)
 	SetupSubmissionRoutes(api)
 	SetupTeamRoutes(api)
+	SetupWriteupRoutes(api)
+	SetupScoreboardRoutes(api)
+	SetupAdminRoutes(api)
 }
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"ctf-backend/controllers"
+	"ctf-backend/database"
+	"ctf-backend/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupScoreboardRoutes(api fiber.Router) {
+	// Use global database instance
+	scoreboardController := controllers.NewScoreboardController(database.DB)
+	bracketController := controllers.NewBracketController(database.DB)
+
+	scoreboardRoutes := api.Group("/scoreboard")
+	scoreboardRoutes.Use(middleware.OptionalAuth())
+	{
+		scoreboardRoutes.Get("/", scoreboardController.GetScoreboard)
+		scoreboardRoutes.Get("/awards", scoreboardController.GetAwards)
+	}
+
+	bracketRoutes := api.Group("/brackets")
+	{
+		// Public routes
+		bracketRoutes.Get("/", bracketController.GetAllBrackets)
+
+		// Protected routes (require admin)
+		bracketRoutes.Use(middleware.RequireAuth(), middleware.RequireAdmin())
+		bracketRoutes.Post("/", bracketController.CreateBracket)
+		bracketRoutes.Put("/:id", bracketController.UpdateBracket)
+		bracketRoutes.Delete("/:id", bracketController.DeleteBracket)
+		bracketRoutes.Get("/:id/pending", bracketController.GetPendingVerifications)
+		bracketRoutes.Put("/:id/users/:userId", bracketController.SetUserBracket)
+		bracketRoutes.Put("/:id/teams/:teamId", bracketController.SetTeamBracket)
+	}
+}
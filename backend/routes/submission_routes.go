@@ -4,6 +4,7 @@ import (
 	"ctf-backend/controllers"
 	"ctf-backend/database"
 	"ctf-backend/middleware"
+	"ctf-backend/models"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,7 +14,7 @@ func SetupSubmissionRoutes(api fiber.Router) {
 	submissionController := controllers.NewSubmissionController(database.DB)
 
 	submissionRoutes := api.Group("/submissions")
-	submissionRoutes.Use(middleware.RequireAuth())
+	submissionRoutes.Use(middleware.RequireAuth(models.ScopeSubmit))
 	{
 		submissionRoutes.Post("/", submissionController.SubmitFlag)
 		submissionRoutes.Get("/", submissionController.GetUserSubmissions)
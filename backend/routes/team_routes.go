@@ -11,12 +11,14 @@ import (
 func SetupTeamRoutes(api fiber.Router) {
 	// Use global database instance
 	teamController := controllers.NewTeamController(database.DB)
+	scoreboardController := controllers.NewScoreboardController(database.DB)
 
 	teamRoutes := api.Group("/teams")
 	{
 		// Public routes
 		teamRoutes.Get("/", teamController.GetAllTeams)
-		teamRoutes.Get("/:id", teamController.GetTeamByID)
+		teamRoutes.Get("/:id", middleware.OptionalAuth(), teamController.GetTeamByID)
+		teamRoutes.Get("/:id/profile", middleware.OptionalAuth(), scoreboardController.GetTeamProfile)
 
 		// Protected routes
 		teamRoutes.Use(middleware.RequireAuth())
@@ -24,6 +26,16 @@ func SetupTeamRoutes(api fiber.Router) {
 		teamRoutes.Put("/:id", teamController.UpdateTeam)
 		teamRoutes.Delete("/:id", teamController.DeleteTeam)
 		teamRoutes.Post("/:id/join", teamController.JoinTeam)
+		teamRoutes.Post("/:id/token", teamController.RotateInviteCode)
 		teamRoutes.Post("/:id/leave", teamController.LeaveTeam)
+		teamRoutes.Delete("/:id/members/:userId", teamController.KickMember)
+
+		// Join requests
+		teamRoutes.Get("/requests/mine", teamController.GetMyJoinRequests)
+		teamRoutes.Post("/:id/requests", teamController.RequestToJoin)
+		teamRoutes.Get("/:id/requests", teamController.GetJoinRequests)
+		teamRoutes.Post("/:id/requests/:requestId/accept", teamController.AcceptJoinRequest)
+		teamRoutes.Post("/:id/requests/:requestId/decline", teamController.DeclineJoinRequest)
+		teamRoutes.Delete("/:id/requests/:requestId", teamController.CancelJoinRequest)
 	}
 }
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"ctf-backend/controllers"
 	"ctf-backend/database"
 	"ctf-backend/middleware"
@@ -11,15 +13,45 @@ import (
 func SetupUserRoutes(api fiber.Router) {
 	// Use global database instance
 	userController := controllers.NewUserController(database.DB)
+	scoreboardController := controllers.NewScoreboardController(database.DB)
+	sessionController := controllers.NewSessionController(database.DB)
+	twoFactorController := controllers.NewTwoFactorController(database.DB)
+	apiTokenController := controllers.NewAPITokenController(database.DB)
 
 	userRoutes := api.Group("/users")
 	{
 		userRoutes.Post("/register", userController.Register)
 		userRoutes.Post("/login", userController.Login)
+		userRoutes.Post("/login/2fa", twoFactorController.VerifyLogin)
+		userRoutes.Post("/refresh", sessionController.Refresh)
+		userRoutes.Post("/verify-email", userController.VerifyEmail)
+		userRoutes.Post("/password/forgot", middleware.RateLimit(5, 15*time.Minute), userController.ForgotPassword)
+		userRoutes.Post("/password/reset", userController.ResetPassword)
 
 		// Protected routes (require authentication)
-		userRoutes.Use(middleware.RequireAuth())
-		userRoutes.Get("/me", userController.GetCurrentUser)
-		userRoutes.Put("/me", userController.UpdateProfile)
+		userRoutes.Get("/me", middleware.RequireAuth(), userController.GetCurrentUser)
+		userRoutes.Put("/me", middleware.RequireAuth(), userController.UpdateProfile)
+		userRoutes.Put("/me/email", middleware.RequireAuth(), userController.ChangeEmail)
+		userRoutes.Put("/me/username", middleware.RequireAuth(), userController.ChangeUsername)
+		userRoutes.Put("/me/password", middleware.RequireAuth(), userController.ChangePassword)
+		userRoutes.Post("/me/verify-email", middleware.RequireAuth(), userController.ResendVerification)
+		userRoutes.Post("/me/2fa/setup", middleware.RequireAuth(), twoFactorController.Setup)
+		userRoutes.Post("/me/2fa/enable", middleware.RequireAuth(), twoFactorController.Enable)
+		userRoutes.Post("/me/2fa/disable", middleware.RequireAuth(), twoFactorController.Disable)
+		userRoutes.Post("/me/2fa/recovery-codes", middleware.RequireAuth(), twoFactorController.RegenerateRecoveryCodes)
+		userRoutes.Post("/logout", middleware.RequireAuth(), sessionController.Logout)
+		userRoutes.Post("/logout/all", middleware.RequireAuth(), sessionController.LogoutAll)
+		userRoutes.Get("/me/sessions", middleware.RequireAuth(), sessionController.GetMySessions)
+		userRoutes.Delete("/me/sessions/:sessionId", middleware.RequireAuth(), sessionController.RevokeMySession)
+		userRoutes.Get("/me/tokens", middleware.RequireAuth(), apiTokenController.GetMyTokens)
+		userRoutes.Post("/me/tokens", middleware.RequireAuth(), apiTokenController.CreateToken)
+		userRoutes.Delete("/me/tokens/:tokenId", middleware.RequireAuth(), apiTokenController.RevokeToken)
+
+		// Admin routes
+		userRoutes.Delete("/:id/sessions", middleware.RequireAuth(), middleware.RequireAdmin(), sessionController.RevokeUserSessions)
+
+		// Public profile, full record for the user themselves and admins
+		userRoutes.Get("/:id", middleware.OptionalAuth(), userController.GetUserByID)
+		userRoutes.Get("/:id/profile", middleware.OptionalAuth(), scoreboardController.GetUserProfile)
 	}
 }
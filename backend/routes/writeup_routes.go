@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"ctf-backend/controllers"
+	"ctf-backend/database"
+	"ctf-backend/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SetupWriteupRoutes(api fiber.Router) {
+	// Use global database instance
+	writeupController := controllers.NewWriteupController(database.DB)
+
+	writeupRoutes := api.Group("/writeups")
+	{
+		// Public routes
+		writeupRoutes.Get("/", writeupController.GetPublicWriteups)
+
+		// Protected routes
+		writeupRoutes.Post("/", middleware.RequireAuth(), writeupController.SubmitWriteup)
+		writeupRoutes.Get("/mine", middleware.RequireAuth(), writeupController.GetMyWriteups)
+
+		// Admin only
+		adminRoutes := writeupRoutes.Group("/admin", middleware.RequireAuth(), middleware.RequireAdmin())
+		{
+			adminRoutes.Get("/pending", writeupController.GetPendingWriteups)
+			adminRoutes.Post("/:id/moderate", writeupController.ModerateWriteup)
+		}
+
+		writeupRoutes.Get("/:id", middleware.OptionalAuth(), writeupController.GetWriteupByID)
+	}
+}